@@ -26,11 +26,76 @@ var signals = []os.Signal{
 }
 
 func main() {
-	if err := kubernetesProvider(); err != nil {
+	run := kubernetesProvider
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			run = func() error {
+				return command(os.Args[2:])
+			}
+		}
+	}
+
+	if err := run(); err != nil {
 		log.Fatal(err)
 	}
 }
 
+const (
+	// validateConfigCommand validates a config file without running a provider command,
+	// so config changes can be checked e.g. in CI before they are rolled out
+	validateConfigCommand = "validate-config"
+	// printConfigCommand prints the config merged from the config file, its overlays
+	// and the environment overrides, to debug layered configs
+	printConfigCommand = "print-config"
+)
+
+// commands are the subcommands besides the provider commands garm runs
+var commands = map[string]func(args []string) error{
+	validateConfigCommand: validateConfig,
+	printConfigCommand:    printConfig,
+}
+
+func validateConfig(args []string) error {
+	configPath, err := parseConfigPath(validateConfigCommand, args)
+	if err != nil {
+		return err
+	}
+
+	if _, err := config.NewConfig(configPath); err != nil {
+		return fmt.Errorf("config %s is invalid: %w", configPath, err)
+	}
+	fmt.Fprintf(os.Stdout, "config %s is valid\n", configPath)
+	return nil
+}
+
+func printConfig(args []string) error {
+	configPath, err := parseConfigPath(printConfigCommand, args)
+	if err != nil {
+		return err
+	}
+
+	effectiveConfig, err := config.EffectiveConfig(configPath)
+	if err != nil {
+		return fmt.Errorf("config %s is invalid: %w", configPath, err)
+	}
+	fmt.Fprint(os.Stdout, string(effectiveConfig))
+	return nil
+}
+
+// parseConfigPath parses the config path of a subcommand,
+// given either by the configpath flag or as the only argument
+func parseConfigPath(command string, args []string) (string, error) {
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	configPath := flags.String("configpath", "", "absolute path to the config.yaml file")
+	if err := flags.Parse(args); err != nil {
+		return "", err
+	}
+	if *configPath == "" && flags.NArg() == 1 {
+		*configPath = flags.Arg(0)
+	}
+	return *configPath, nil
+}
+
 func kubernetesProvider() error {
 	ctx, stop := signal.NotifyContext(context.Background(), signals...)
 	defer stop()
@@ -47,33 +112,41 @@ func kubernetesProvider() error {
 		*configPath = executionEnv.ProviderConfigFile
 	}
 
-	err = config.NewConfig(*configPath)
+	cfg, err := config.NewConfig(*configPath)
 	if err != nil {
 		return fmt.Errorf("could not initialize config: %w", err)
 	}
 
-	// generate a k8s client config
-	var restConfig *rest.Config
-	if config.Config.KubeConfigPath == "" {
-		restConfig, err = rest.InClusterConfig()
-		if err != nil {
-			return fmt.Errorf("could not initialize in-cluster config client: %w", err)
+	// create a new kubernetes clientset for the default cluster
+	clientset, err := newClientSet(cfg, cfg.DefaultCluster())
+	if err != nil {
+		// the default cluster is optional if all pools are routed to named clusters
+		if len(cfg.Clusters) == 0 {
+			return err
 		}
-	} else {
-		restConfig, err = clientcmd.BuildConfigFromFlags("", config.Config.KubeConfigPath)
+		log.Printf("default cluster is not available: %v", err)
+	}
+
+	clusters := make([]provider.Cluster, 0, len(cfg.Clusters))
+	for name, clusterConfig := range cfg.Clusters {
+		clusterClientset, err := newClientSet(cfg, clusterConfig)
 		if err != nil {
-			return fmt.Errorf("could not initialize kubernetes config client: %w", err)
+			return fmt.Errorf("cluster %s: %w", name, err)
 		}
+		clusters = append(clusters, provider.Cluster{
+			Name:      name,
+			ClientSet: clusterClientset,
+			Namespace: clusterConfig.RunnerNamespace,
+			Flavors:   clusterConfig.Flavors,
+		})
 	}
 
-	// create a new kubernetes clientset
-	clientset, err := kubernetes.NewForConfig(restConfig)
-	if err != nil {
-		return fmt.Errorf("could not initialize kube client: %w", err)
+	// create a new kubernetes provider, without a typed nil as default cluster
+	var defaultClientSet kubernetes.Interface
+	if clientset != nil {
+		defaultClientSet = clientset
 	}
-
-	// create a new kubernetes provider
-	prov, err := provider.NewKubernetesProvider(clientset, executionEnv.ControllerID, executionEnv.PoolID)
+	prov, err := provider.NewKubernetesProvider(cfg, defaultClientSet, executionEnv.ControllerID, executionEnv.PoolID, clusters...)
 	if err != nil {
 		return fmt.Errorf("could not initialize provider: %w", err)
 	}
@@ -87,3 +160,55 @@ func kubernetesProvider() error {
 	}
 	return nil
 }
+
+// newClientSet creates a kubernetes clientset for the given cluster connection.
+// Without any connection settings, the in cluster config is used.
+func newClientSet(cfg *config.ProviderConfig, cluster config.ClusterConfig) (*kubernetes.Clientset, error) {
+	restConfig, err := newRestConfig(cluster)
+	if err != nil {
+		return nil, fmt.Errorf("could not initialize kubernetes config client: %w", err)
+	}
+
+	// garm forks a provider process per command, so limits apply per process
+	restConfig.QPS = cfg.QPS
+	restConfig.Burst = cfg.Burst
+
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("could not initialize kube client: %w", err)
+	}
+	return clientset, nil
+}
+
+func newRestConfig(cluster config.ClusterConfig) (*rest.Config, error) {
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: cluster.KubeContext}
+
+	switch {
+	case cluster.KubeConfig != "":
+		kubeConfig, err := clientcmd.Load([]byte(cluster.KubeConfig))
+		if err != nil {
+			return nil, fmt.Errorf("could not parse inline kubeconfig: %w", err)
+		}
+		return clientcmd.NewNonInteractiveClientConfig(*kubeConfig, cluster.KubeContext, overrides, nil).ClientConfig()
+	case cluster.KubeConfigPath != "":
+		return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+			&clientcmd.ClientConfigLoadingRules{ExplicitPath: cluster.KubeConfigPath},
+			overrides,
+		).ClientConfig()
+	case cluster.APIServerURL != "":
+		// the token file is re-read periodically, so short-lived projected tokens can be used
+		return &rest.Config{
+			Host:            cluster.APIServerURL,
+			BearerTokenFile: cluster.BearerTokenFile,
+			TLSClientConfig: rest.TLSClientConfig{
+				CAFile: cluster.CAFile,
+			},
+		}, nil
+	default:
+		restConfig, err := rest.InClusterConfig()
+		if err != nil {
+			return nil, fmt.Errorf("could not initialize in-cluster config: %w", err)
+		}
+		return restConfig, nil
+	}
+}
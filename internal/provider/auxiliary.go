@@ -0,0 +1,244 @@
+// SPDX-License-Identifier: MIT
+
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/mercedes-benz/garm-provider-k8s/internal/spec"
+)
+
+// cleanupTimeout bounds the cleanup of a failed command
+const cleanupTimeout = 30 * time.Second
+
+// auxiliaryClient is implemented by the typed clients of all kinds
+// the provider creates alongside a runner pod
+type auxiliaryClient[T, L runtime.Object] interface {
+	Create(ctx context.Context, obj T, opts metav1.CreateOptions) (T, error)
+	Update(ctx context.Context, obj T, opts metav1.UpdateOptions) (T, error)
+	Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (T, error)
+	Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error
+	List(ctx context.Context, opts metav1.ListOptions) (L, error)
+}
+
+// auxiliaryKind wraps an auxiliaryClient, so all kinds can be handled the same way
+type auxiliaryKind struct {
+	kind  string
+	apply func(ctx context.Context, obj runtime.Object) error
+	patch func(ctx context.Context, name string, patch []byte) error
+	del   func(ctx context.Context, name string) error
+	list  func(ctx context.Context, selector labels.Selector) ([]metav1.Object, error)
+}
+
+func newAuxiliaryKind[T, L runtime.Object](kind string, client auxiliaryClient[T, L]) auxiliaryKind {
+	return auxiliaryKind{
+		kind: kind,
+		apply: func(ctx context.Context, obj runtime.Object) error {
+			typed, ok := obj.(T)
+			if !ok {
+				return fmt.Errorf("object is not a %s", kind)
+			}
+			_, err := withRetry(ctx, func() (T, error) {
+				return client.Create(ctx, typed, metav1.CreateOptions{})
+			})
+			// objects might be left over from a former attempt
+			if apierrors.IsAlreadyExists(err) {
+				_, err = withRetry(ctx, func() (T, error) {
+					return client.Update(ctx, typed, metav1.UpdateOptions{})
+				})
+			}
+			return err
+		},
+		patch: func(ctx context.Context, name string, patch []byte) error {
+			_, err := withRetry(ctx, func() (T, error) {
+				return client.Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{})
+			})
+			return err
+		},
+		del: func(ctx context.Context, name string) error {
+			err := retryOnError(ctx, func() error {
+				return client.Delete(ctx, name, metav1.DeleteOptions{})
+			})
+			if err != nil && !apierrors.IsNotFound(err) {
+				return err
+			}
+			return nil
+		},
+		list: func(ctx context.Context, selector labels.Selector) ([]metav1.Object, error) {
+			list, err := withRetry(ctx, func() (L, error) {
+				return client.List(ctx, metav1.ListOptions{
+					LabelSelector: selector.String(),
+				})
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			items, err := meta.ExtractList(list)
+			if err != nil {
+				return nil, err
+			}
+
+			objects := make([]metav1.Object, 0, len(items))
+			for _, item := range items {
+				object, err := meta.Accessor(item)
+				if err != nil {
+					return nil, err
+				}
+				objects = append(objects, object)
+			}
+			return objects, nil
+		},
+	}
+}
+
+// auxiliaryKinds returns the kinds of auxiliary objects the provider creates in the runner namespace.
+// Only these kinds are listed, so the provider doesn't need permissions for any other kind.
+func (c cluster) auxiliaryKinds() []auxiliaryKind {
+	coreV1 := c.ClientSet.CoreV1()
+	namespace := c.namespace
+
+	return []auxiliaryKind{
+		newAuxiliaryKind[*corev1.Secret, *corev1.SecretList]("Secret", coreV1.Secrets(namespace)),
+		newAuxiliaryKind[*corev1.ConfigMap, *corev1.ConfigMapList]("ConfigMap", coreV1.ConfigMaps(namespace)),
+	}
+}
+
+func (c cluster) auxiliaryKindOf(obj runtime.Object) (auxiliaryKind, error) {
+	var kind string
+	switch obj.(type) {
+	case *corev1.Secret:
+		kind = "Secret"
+	case *corev1.ConfigMap:
+		kind = "ConfigMap"
+	}
+
+	for _, auxiliaryKind := range c.auxiliaryKinds() {
+		if auxiliaryKind.kind == kind {
+			return auxiliaryKind, nil
+		}
+	}
+	return auxiliaryKind{}, fmt.Errorf("unsupported auxiliary object %T", obj)
+}
+
+// createAuxiliaryObjects creates all objects which have to exist before the runner pod.
+// Already created objects are deleted again if one of them can not be created.
+func (c cluster) createAuxiliaryObjects(ctx context.Context, podName string, objects []runtime.Object) error {
+	for _, obj := range objects {
+		auxiliaryKind, err := c.auxiliaryKindOf(obj)
+		if err == nil {
+			err = auxiliaryKind.apply(ctx, obj)
+		}
+		if err != nil {
+			c.cleanupAuxiliaryObjects(ctx, podName)
+			return err
+		}
+	}
+	return nil
+}
+
+// adoptAuxiliaryObjects sets the given owner on all auxiliary objects of a runner pod,
+// so they get garbage collected together with their owner.
+// The parked configmap of a stopped instance is never adopted.
+func (c cluster) adoptAuxiliaryObjects(ctx context.Context, podName string, owner metav1.OwnerReference) error {
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{
+			"ownerReferences": []metav1.OwnerReference{owner},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, auxiliaryKind := range c.auxiliaryKinds() {
+		objects, err := auxiliaryKind.list(ctx, podNameSelector(podName))
+		if err != nil {
+			return err
+		}
+
+		for _, object := range objects {
+			if object.GetLabels()[spec.GarmStoppedLabel] == "true" {
+				continue
+			}
+			if err := auxiliaryKind.patch(ctx, object.GetName(), patch); err != nil {
+				return fmt.Errorf("can not set owner of %s %s: %w", auxiliaryKind.kind, object.GetName(), err)
+			}
+		}
+	}
+	return nil
+}
+
+// deleteAuxiliaryObjects deletes all auxiliary objects matching the given selector
+func (c cluster) deleteAuxiliaryObjects(ctx context.Context, selector labels.Selector) error {
+	for _, auxiliaryKind := range c.auxiliaryKinds() {
+		objects, err := auxiliaryKind.list(ctx, selector)
+		if err != nil {
+			return err
+		}
+
+		for _, object := range objects {
+			if err := auxiliaryKind.del(ctx, object.GetName()); err != nil {
+				return fmt.Errorf("can not delete %s %s: %w", auxiliaryKind.kind, object.GetName(), err)
+			}
+		}
+	}
+	return nil
+}
+
+// cleanupAuxiliaryObjects deletes the auxiliary objects of a runner pod which could not be created.
+// It is not aborted if the command got canceled, otherwise the objects would be left behind.
+func (c cluster) cleanupAuxiliaryObjects(ctx context.Context, podName string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+	defer cancel()
+
+	if err := c.deleteAuxiliaryObjects(ctx, podNameSelector(podName)); err != nil {
+		slog.Error(fmt.Sprintf("Error deleting auxiliary objects of pod: %v in namespace %v: %v", podName, c.namespace, err))
+	}
+}
+
+// sweepAuxiliaryObjects deletes all auxiliary objects of the pool
+// whose runner pod is not in the given set of pods to keep
+func (c cluster) sweepAuxiliaryObjects(ctx context.Context, keep map[string]bool) {
+	auxiliaryRequirement, err := labels.NewRequirement(spec.GarmPodNameLabel, selection.Exists, nil)
+	if err != nil {
+		slog.Error(fmt.Sprintf("Error building selector for auxiliary objects: %v", err))
+		return
+	}
+	selector := c.LabelSelector.Add(*auxiliaryRequirement)
+
+	for _, auxiliaryKind := range c.auxiliaryKinds() {
+		objects, err := auxiliaryKind.list(ctx, selector)
+		if err != nil {
+			slog.Error(fmt.Sprintf("Error listing %s objects in namespace %v: %v", auxiliaryKind.kind, c.namespace, err))
+			continue
+		}
+
+		for _, object := range objects {
+			if keep[object.GetLabels()[spec.GarmPodNameLabel]] {
+				continue
+			}
+			if err := auxiliaryKind.del(ctx, object.GetName()); err != nil {
+				slog.Error(fmt.Sprintf("Error deleting %s: %v in namespace %v", auxiliaryKind.kind, object.GetName(), object.GetNamespace()))
+			}
+		}
+	}
+}
+
+func podNameSelector(podName string) labels.Selector {
+	return labels.SelectorFromSet(labels.Set{
+		spec.GarmPodNameLabel: podName,
+	})
+}
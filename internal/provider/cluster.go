@@ -0,0 +1,172 @@
+// SPDX-License-Identifier: MIT
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/cloudbase/garm-provider-common/params"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/mercedes-benz/garm-provider-k8s/internal/spec"
+)
+
+// clusterSeparator separates the cluster from the pod name in the ProviderID
+// of instances running in a named cluster
+const clusterSeparator = "/"
+
+// Cluster is a named cluster runner pods can be routed to
+type Cluster struct {
+	Name      string
+	ClientSet kubernetes.Interface
+	Namespace string
+	// Flavors of pools which are routed to this cluster
+	Flavors []string
+}
+
+// cluster is the provider bound to one of its clusters.
+// The default cluster has no name.
+type cluster struct {
+	Provider
+	name      string
+	namespace string
+}
+
+func (p Provider) defaultCluster() (cluster, error) {
+	if p.ClientSet == nil {
+		return cluster{}, fmt.Errorf("no default cluster configured")
+	}
+	return cluster{
+		Provider:  p,
+		name:      "",
+		namespace: p.Config.RunnerNamespace,
+	}, nil
+}
+
+func (p Provider) namedCluster(name string) (cluster, error) {
+	for _, named := range p.Clusters {
+		if named.Name == name {
+			c := cluster{
+				Provider:  p,
+				name:      named.Name,
+				namespace: named.Namespace,
+			}
+			c.ClientSet = named.ClientSet
+			return c, nil
+		}
+	}
+	return cluster{}, fmt.Errorf("cluster %s is not configured", name)
+}
+
+// allClusters returns the default cluster, if configured, and all named clusters
+func (p Provider) allClusters() []cluster {
+	clusters := make([]cluster, 0, len(p.Clusters)+1)
+	if c, err := p.defaultCluster(); err == nil {
+		clusters = append(clusters, c)
+	}
+	for _, named := range p.Clusters {
+		c, _ := p.namedCluster(named.Name)
+		clusters = append(clusters, c)
+	}
+	return clusters
+}
+
+// clusterForPool returns the cluster a pool is routed to.
+// The cluster of the extra_specs takes precedence over the cluster the flavor is assigned to.
+// Pools without a matching cluster run in the default cluster.
+func (p Provider) clusterForPool(flavor string, extraSpecs spec.ExtraSpecs) (cluster, error) {
+	if extraSpecs.Cluster != "" {
+		return p.namedCluster(extraSpecs.Cluster)
+	}
+
+	for _, named := range p.Clusters {
+		if slices.Contains(named.Flavors, flavor) {
+			return p.namedCluster(named.Name)
+		}
+	}
+	return p.defaultCluster()
+}
+
+// clusterForInstance returns the cluster of an instance and the name of its pod.
+// Instances without a cluster in their ProviderID are looked up in all clusters,
+// as garm falls back to the instance name if an instance got no ProviderID.
+func (p Provider) clusterForInstance(ctx context.Context, instance string) (cluster, string, error) {
+	if clusterName, name, found := strings.Cut(instance, clusterSeparator); found {
+		c, err := p.namedCluster(clusterName)
+		if err != nil {
+			return cluster{}, "", err
+		}
+		podName, _ := c.resolvePodName(ctx, name)
+		return c, podName, nil
+	}
+
+	clusters := p.allClusters()
+	if len(clusters) == 0 {
+		return cluster{}, "", fmt.Errorf("no cluster configured")
+	}
+
+	for _, c := range clusters {
+		if podName, found := c.resolvePodName(ctx, instance); found {
+			return c, podName, nil
+		}
+	}
+	return clusters[0], spec.PodName(instance), nil
+}
+
+// resolvePodName returns the name of the pod of an instance, given either the instance name
+// or the pod name, and if the pod or its parked configmap exists in this cluster.
+// Pods are looked up by their instance name label first, as pod names of long
+// or invalid instance names can not be mapped back to the instance name.
+func (c cluster) resolvePodName(ctx context.Context, instance string) (string, bool) {
+	instanceRequirement, err := labels.NewRequirement(spec.GarmInstanceNameLabel, selection.Equals, []string{spec.ToValidLabel(instance)})
+	if err == nil {
+		selector := c.LabelSelector.Add(*instanceRequirement).String()
+
+		pods, err := withRetry(ctx, func() (*corev1.PodList, error) {
+			return c.ClientSet.CoreV1().
+				Pods(c.namespace).
+				List(ctx, metav1.ListOptions{LabelSelector: selector})
+		})
+		if err == nil && len(pods.Items) == 1 {
+			return pods.Items[0].Name, true
+		}
+
+		parkedConfigMaps, err := c.listParkedConfigMaps(ctx, *instanceRequirement)
+		if err == nil && len(parkedConfigMaps.Items) == 1 {
+			return parkedConfigMaps.Items[0].Name, true
+		}
+	}
+
+	// the instance is given by its pod name or was created before pods got the instance name label
+	podName := spec.PodName(instance)
+	_, err = withRetry(ctx, func() (*corev1.Pod, error) {
+		return c.ClientSet.CoreV1().
+			Pods(c.namespace).
+			Get(ctx, podName, metav1.GetOptions{})
+	})
+	return podName, err == nil || c.isParked(ctx, podName)
+}
+
+// providerID returns the ProviderID of a pod in this cluster
+func (c cluster) providerID(podName string) string {
+	if c.name == "" {
+		return podName
+	}
+	return c.name + clusterSeparator + podName
+}
+
+func (c cluster) podToInstance(pod *corev1.Pod, overwriteInstanceStatus params.InstanceStatus) (*params.ProviderInstance, error) {
+	result, err := spec.PodToInstance(pod, overwriteInstanceStatus)
+	if err != nil {
+		return nil, err
+	}
+	result.ProviderID = c.providerID(pod.Name)
+	return result, nil
+}
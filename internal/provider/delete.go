@@ -0,0 +1,96 @@
+// SPDX-License-Identifier: MIT
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+
+	"github.com/mercedes-benz/garm-provider-k8s/internal/spec"
+)
+
+// deleteOptions returns the configured options to delete runner pods with
+func (p Provider) deleteOptions() metav1.DeleteOptions {
+	deleteOptions := metav1.DeleteOptions{
+		GracePeriodSeconds: p.Config.GracePeriodSeconds,
+	}
+	if p.Config.PropagationPolicy != "" {
+		deleteOptions.PropagationPolicy = ptr.To(metav1.DeletionPropagation(p.Config.PropagationPolicy))
+	}
+
+	// the grace period of the delete call overrides the one of the pod,
+	// so it must not cut the deregistration of the runner short
+	if deleteOptions.GracePeriodSeconds != nil && len(p.Config.DeregistrationCommand) > 0 {
+		deregistrationGracePeriodSeconds := spec.DeregistrationGracePeriodSeconds(p.Config.DeregistrationTimeout)
+		if *deleteOptions.GracePeriodSeconds < deregistrationGracePeriodSeconds {
+			deleteOptions.GracePeriodSeconds = ptr.To(deregistrationGracePeriodSeconds)
+		}
+	}
+	return deleteOptions
+}
+
+// deletePod deletes a runner pod with the configured delete options.
+// The pod is deleted without grace period if forced or if it can not terminate gracefully anymore.
+func (c cluster) deletePod(ctx context.Context, pod *corev1.Pod, force bool) error {
+	deleteOptions := c.deleteOptions()
+	if force || c.needsForceDelete(ctx, pod) {
+		deleteOptions.GracePeriodSeconds = ptr.To[int64](0)
+	}
+
+	return retryOnError(ctx, func() error {
+		return c.ClientSet.CoreV1().
+			Pods(c.namespace).
+			Delete(ctx, pod.Name, deleteOptions)
+	})
+}
+
+// needsForceDelete reports if a pod has been terminating for longer than configured
+// or if its node is not ready, so the kubelet will never confirm the graceful deletion
+func (c cluster) needsForceDelete(ctx context.Context, pod *corev1.Pod) bool {
+	if c.Config.ForceDeleteAfter > 0 && pod.DeletionTimestamp != nil {
+		terminatingSince := pod.DeletionTimestamp.Time
+		if pod.DeletionGracePeriodSeconds != nil {
+			terminatingSince = terminatingSince.Add(-time.Duration(*pod.DeletionGracePeriodSeconds) * time.Second)
+		}
+		if time.Since(terminatingSince) > c.Config.ForceDeleteAfter {
+			slog.Info(fmt.Sprintf("Force deleting pod %s in namespace %s, it is terminating since %s", pod.Name, c.namespace, terminatingSince.Format(time.RFC3339)))
+			return true
+		}
+	}
+
+	if c.Config.ForceDeleteOnNodeNotReady && pod.Spec.NodeName != "" {
+		node, err := withRetry(ctx, func() (*corev1.Node, error) {
+			return c.ClientSet.CoreV1().
+				Nodes().
+				Get(ctx, pod.Spec.NodeName, metav1.GetOptions{})
+		})
+		switch {
+		case apierrors.IsNotFound(err):
+			slog.Info(fmt.Sprintf("Force deleting pod %s in namespace %s, its node %s does not exist anymore", pod.Name, c.namespace, pod.Spec.NodeName))
+			return true
+		case err != nil:
+			slog.Error(fmt.Sprintf("Error getting node %s of pod %s: %v", pod.Spec.NodeName, pod.Name, err))
+		case !nodeReady(node):
+			slog.Info(fmt.Sprintf("Force deleting pod %s in namespace %s, its node %s is not ready", pod.Name, c.namespace, pod.Spec.NodeName))
+			return true
+		}
+	}
+
+	return false
+}
+
+func nodeReady(node *corev1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -5,16 +5,25 @@ package provider
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"reflect"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/cloudbase/garm-provider-common/params"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
 
 	"github.com/mercedes-benz/garm-provider-k8s/internal/spec"
@@ -24,25 +33,102 @@ import (
 
 const (
 	runnerContainerName = "runner"
+	// defaultDeleteConcurrency is the number of pods deleted in parallel by RemoveAllInstances
+	defaultDeleteConcurrency = 10
+	// defaultDeleteTimeout is the time RemoveAllInstances waits for deleted pods to be gone
+	defaultDeleteTimeout = 2 * time.Minute
+	deletePollInterval   = time.Second
+	// deregistrationWaitMargin is waited on top of the termination grace period of a deregistering pod,
+	// the kubelet gives a preStop hook 2s more before it kills the container and the pod is removed afterwards
+	deregistrationWaitMargin = 10 * time.Second
 )
 
 type Provider struct {
-	ControllerID  string
+	ControllerID string
+	// ClientSet of the default cluster
 	ClientSet     kubernetes.Interface
 	LabelSelector labels.Selector
+	// Clusters are named clusters pools can be routed to
+	Clusters []Cluster
+	// Config is the provider config all clusters share
+	Config *config.ProviderConfig
 }
 
-func (p Provider) CreateInstance(_ context.Context, bootstrapParams params.BootstrapInstance) (params.ProviderInstance, error) {
-	podName := strings.ToLower(bootstrapParams.Name)
+func (p Provider) deleteConcurrency() int {
+	if p.Config.DeleteConcurrency > 0 {
+		return p.Config.DeleteConcurrency
+	}
+	return defaultDeleteConcurrency
+}
+
+func (p Provider) deleteTimeout() time.Duration {
+	if p.Config.DeleteTimeout > 0 {
+		return p.Config.DeleteTimeout
+	}
+	return defaultDeleteTimeout
+}
+
+// deregistrationTimeout is the time DeleteInstance waits for the runner of the pod to deregister,
+// which is the termination grace period the pod is deleted with plus a margin
+func (p Provider) deregistrationTimeout(pod *corev1.Pod) time.Duration {
+	if p.Config.DeregistrationTimeout <= 0 {
+		return p.deleteTimeout()
+	}
+
+	gracePeriodSeconds := int64(corev1.DefaultTerminationGracePeriodSeconds)
+	if deleteOptions := p.deleteOptions(); deleteOptions.GracePeriodSeconds != nil {
+		gracePeriodSeconds = *deleteOptions.GracePeriodSeconds
+	} else if pod.Spec.TerminationGracePeriodSeconds != nil {
+		gracePeriodSeconds = *pod.Spec.TerminationGracePeriodSeconds
+	}
+	return time.Duration(gracePeriodSeconds)*time.Second + deregistrationWaitMargin
+}
+
+// withOperationTimeout derives the context of a single provider command,
+// bounded by the configured operation timeout if one is set
+func (p Provider) withOperationTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if p.Config.OperationTimeout > 0 {
+		return context.WithTimeout(ctx, p.Config.OperationTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+func (p Provider) CreateInstance(ctx context.Context, bootstrapParams params.BootstrapInstance) (params.ProviderInstance, error) {
+	ctx, cancel := p.withOperationTimeout(ctx)
+	defer cancel()
+
+	podName := spec.PodName(bootstrapParams.Name)
 	labels := spec.ParamsToPodLabels(p.ControllerID, bootstrapParams)
-	resourceRequirements := spec.FlavorToResourceRequirements(bootstrapParams.Flavor)
 
 	gitHubScopeDetails, err := spec.ExtractGitHubScopeDetails(bootstrapParams.RepoURL)
 	if err != nil {
 		return params.ProviderInstance{}, err
 	}
 
-	envs := spec.GetRunnerEnvs(gitHubScopeDetails, bootstrapParams)
+	envs := spec.GetRunnerEnvs(gitHubScopeDetails, bootstrapParams, spec.RunnerSecretName(podName))
+
+	extraSpecs, err := spec.ParseExtraSpecs(bootstrapParams.ExtraSpecs)
+	if err != nil {
+		return params.ProviderInstance{}, fmt.Errorf("error calling CreateInstance: invalid extra_specs for pool %s: %w", bootstrapParams.PoolID, err)
+	}
+
+	// a pool with an unknown flavor is created like one with the default flavor, if configured
+	flavor, err := spec.ResolveFlavor(p.Config, bootstrapParams.Flavor)
+	if err != nil {
+		return params.ProviderInstance{}, fmt.Errorf("error calling CreateInstance: invalid flavor of pool %s: %w", bootstrapParams.PoolID, err)
+	}
+
+	c, err := p.clusterForPool(flavor, extraSpecs)
+	if err != nil {
+		return params.ProviderInstance{}, fmt.Errorf("error calling CreateInstance: %w", err)
+	}
+
+	flavorPodTemplate := spec.FlavorPodTemplate(p.Config, flavor, runnerContainerName)
+
+	namedPodTemplate, err := spec.NamedPodTemplate(p.Config, flavor, extraSpecs)
+	if err != nil {
+		return params.ProviderInstance{}, fmt.Errorf("error calling CreateInstance: %w", err)
+	}
 
 	pod := &corev1.Pod{
 		TypeMeta: metav1.TypeMeta{
@@ -50,9 +136,10 @@ func (p Provider) CreateInstance(_ context.Context, bootstrapParams params.Boots
 			Kind:       "Pod",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      podName,
-			Namespace: config.Config.RunnerNamespace,
-			Labels:    labels,
+			Name:        podName,
+			Namespace:   c.namespace,
+			Labels:      labels,
+			Annotations: spec.ParamsToPodAnnotations(bootstrapParams),
 		},
 		Spec: corev1.PodSpec{
 			RestartPolicy: corev1.RestartPolicyNever,
@@ -60,7 +147,6 @@ func (p Provider) CreateInstance(_ context.Context, bootstrapParams params.Boots
 				{
 					Name:            runnerContainerName,
 					Image:           bootstrapParams.Image,
-					Resources:       resourceRequirements,
 					Env:             envs,
 					ImagePullPolicy: corev1.PullAlways,
 				},
@@ -68,34 +154,138 @@ func (p Provider) CreateInstance(_ context.Context, bootstrapParams params.Boots
 		},
 	}
 
-	err = p.ensureNamespace(config.Config.RunnerNamespace)
+	err = c.ensureNamespace(ctx, c.namespace)
+	if err != nil {
+		return params.ProviderInstance{}, fmt.Errorf("ensuring runner namespace %s failed: %w", c.namespace, err)
+	}
+
+	err = spec.CreateRunnerVolume(p.Config, pod, flavorPodTemplate, namedPodTemplate, extraSpecs.PodTemplate)
+	if err != nil {
+		return params.ProviderInstance{}, err
+	}
+
+	err = spec.CreateRunnerVolumeMount(p.Config, pod, runnerContainerName, flavorPodTemplate, namedPodTemplate, extraSpecs.PodTemplate)
+	if err != nil {
+		return params.ProviderInstance{}, err
+	}
+
+	if len(bootstrapParams.CACertBundle) > 0 {
+		err = spec.AddCABundle(pod, runnerContainerName)
+		if err != nil {
+			return params.ProviderInstance{}, err
+		}
+	}
+
+	if len(p.Config.DeregistrationCommand) > 0 {
+		err = spec.AddDeregistrationHook(pod, runnerContainerName, p.Config.DeregistrationCommand, p.Config.DeregistrationTimeout)
+		if err != nil {
+			return params.ProviderInstance{}, err
+		}
+	}
+
+	installMode, err := spec.RunnerInstallMode(p.Config, extraSpecs)
+	if err != nil {
+		return params.ProviderInstance{}, fmt.Errorf("error calling CreateInstance: invalid extra_specs for pool %s: %w", bootstrapParams.PoolID, err)
+	}
+
+	var tool *params.RunnerApplicationDownload
+	if installMode == config.RunnerInstallModeTools {
+		selectedTool, err := spec.RunnerTool(bootstrapParams.OSType, bootstrapParams.OSArch, bootstrapParams.Tools)
+		if err != nil {
+			return params.ProviderInstance{}, fmt.Errorf("error calling CreateInstance: %w", err)
+		}
+		tool = &selectedTool
+
+		err = spec.AddRunnerTools(p.Config, pod, runnerContainerName, selectedTool, spec.RunnerSecretName(podName))
+		if err != nil {
+			return params.ProviderInstance{}, fmt.Errorf("error calling CreateInstance: %w", err)
+		}
+	}
+
+	// the global pod template takes precedence over the flavor, a named pod template over both
+	mergedPod, err := mergePodSpecs(pod, flavorPodTemplate)
 	if err != nil {
-		return params.ProviderInstance{}, fmt.Errorf("ensuring runner namespace %s failed: %w", config.Config.RunnerNamespace, err)
+		return params.ProviderInstance{}, err
 	}
 
-	err = spec.CreateRunnerVolume(pod)
+	mergedPod, err = mergePodSpecs(mergedPod, p.Config.PodTemplate)
 	if err != nil {
 		return params.ProviderInstance{}, err
 	}
 
-	err = spec.CreateRunnerVolumeMount(pod, runnerContainerName)
+	mergedPod, err = mergePodSpecs(mergedPod, namedPodTemplate)
 	if err != nil {
 		return params.ProviderInstance{}, err
 	}
 
-	mergedPod, err := mergePodSpecs(pod, config.Config.PodTemplate)
+	// pool specific pod template from extra_specs takes precedence over the global one
+	mergedPod, err = mergePodSpecs(mergedPod, extraSpecs.PodTemplate)
 	if err != nil {
 		return params.ProviderInstance{}, err
 	}
 
-	pod, err = p.ClientSet.CoreV1().
-		Pods(config.Config.RunnerNamespace).
-		Create(context.Background(), mergedPod, metav1.CreateOptions{})
+	err = spec.PersistPodSpec(mergedPod)
 	if err != nil {
-		return params.ProviderInstance{}, fmt.Errorf("error calling CreateInstance: can not create pod %v: %w", pod.Name, err)
+		return params.ProviderInstance{}, err
 	}
 
-	result, err := spec.PodToInstance(pod, params.InstanceRunning)
+	// garm retries CreateInstance after a timeout, the pod of the former attempt is taken over
+	pod, err = c.existingInstancePod(ctx, mergedPod)
+	if err != nil {
+		return params.ProviderInstance{}, fmt.Errorf("error calling CreateInstance: %w", err)
+	}
+
+	if pod == nil {
+		// auxiliary objects have to exist before the pod, otherwise the runner container can't be started
+		runnerSecret := spec.NewRunnerSecret(mergedPod, bootstrapParams)
+		auxiliaryObjects := []runtime.Object{runnerSecret}
+		if len(bootstrapParams.CACertBundle) > 0 {
+			auxiliaryObjects = append(auxiliaryObjects, spec.NewCABundleConfigMap(mergedPod, bootstrapParams.CACertBundle))
+		}
+		if tool != nil {
+			spec.AddToolsDownloadToken(runnerSecret, *tool)
+			auxiliaryObjects = append(auxiliaryObjects, spec.NewEntrypointConfigMap(mergedPod))
+		}
+		err = c.createAuxiliaryObjects(ctx, mergedPod.Name, auxiliaryObjects)
+		if err != nil {
+			return params.ProviderInstance{}, fmt.Errorf("error calling CreateInstance: can not create auxiliary objects of pod %v: %w", mergedPod.Name, err)
+		}
+
+		pod, err = withRetry(ctx, func() (*corev1.Pod, error) {
+			return c.ClientSet.CoreV1().
+				Pods(c.namespace).
+				Create(ctx, mergedPod, metav1.CreateOptions{})
+		})
+		switch {
+		case apierrors.IsAlreadyExists(err):
+			// the pod got created by a concurrent attempt in the meantime
+			pod, err = c.existingInstancePod(ctx, mergedPod)
+			if err == nil && pod == nil {
+				err = fmt.Errorf("pod %s was deleted while it got created", mergedPod.Name)
+			}
+			if err != nil {
+				return params.ProviderInstance{}, fmt.Errorf("error calling CreateInstance: %w", err)
+			}
+		case err != nil:
+			// don't leave anything behind of a pod which was never created
+			c.cleanupAuxiliaryObjects(ctx, mergedPod.Name)
+			return params.ProviderInstance{}, fmt.Errorf("error calling CreateInstance: can not create pod %v: %w", mergedPod.Name, err)
+		}
+	}
+
+	err = c.adoptAuxiliaryObjects(ctx, pod.Name, spec.OwnerReference(pod, "Pod"))
+	if err != nil {
+		return params.ProviderInstance{}, fmt.Errorf("error calling CreateInstance: %w", err)
+	}
+
+	if p.Config.PodReadyTimeout > 0 {
+		err = c.waitForPodStartup(ctx, pod)
+		if err != nil {
+			return params.ProviderInstance{}, fmt.Errorf("error calling CreateInstance: %w", err)
+		}
+	}
+
+	result, err := c.podToInstance(pod, params.InstanceRunning)
 	if err != nil {
 		return params.ProviderInstance{}, fmt.Errorf("error calling CreateInstance: can not map pod %v to params.Instance: %w", pod.Name, err)
 	}
@@ -103,10 +293,96 @@ func (p Provider) CreateInstance(_ context.Context, bootstrapParams params.Boots
 	return *result, nil
 }
 
-func (p Provider) ensureNamespace(runnerNamespace string) error {
-	_, err := p.ClientSet.CoreV1().
-		Namespaces().
-		Get(context.Background(), runnerNamespace, metav1.GetOptions{})
+// existingInstancePod returns the already existing pod of the given runner pod, or nil if there is none.
+// An error is returned if a pod with the same name belongs to another instance.
+func (c cluster) existingInstancePod(ctx context.Context, desired *corev1.Pod) (*corev1.Pod, error) {
+	existing, err := withRetry(ctx, func() (*corev1.Pod, error) {
+		return c.ClientSet.CoreV1().
+			Pods(c.namespace).
+			Get(ctx, desired.Name, metav1.GetOptions{})
+	})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can not get pod %s: %w", desired.Name, err)
+	}
+
+	if !spec.SameInstance(existing, desired.Labels) {
+		return nil, fmt.Errorf("pod %s already exists in namespace %s, but belongs to instance %q of pool %q of controller %q",
+			existing.Name,
+			c.namespace,
+			existing.Labels[spec.GarmInstanceNameLabel],
+			existing.Labels[spec.GarmPoolIDLabel],
+			existing.Labels[spec.GarmControllerIDLabel])
+	}
+	return existing, nil
+}
+
+// waitForPodStartup watches the given pod until it is scheduled and the runner container got started.
+// It fails as soon as the pod can not be started or the configured PodReadyTimeout is exceeded.
+func (c cluster) waitForPodStartup(ctx context.Context, pod *corev1.Pod) error {
+	ctx, cancel := context.WithTimeout(ctx, c.Config.PodReadyTimeout)
+	defer cancel()
+
+	watcher, err := c.ClientSet.CoreV1().
+		Pods(pod.Namespace).
+		Watch(ctx, metav1.ListOptions{
+			FieldSelector:   fields.OneTermEqualSelector("metadata.name", pod.Name).String(),
+			ResourceVersion: pod.ResourceVersion,
+		})
+	if err != nil {
+		return fmt.Errorf("can not watch pod %s: %w", pod.Name, err)
+	}
+	defer watcher.Stop()
+
+	// re-read the pod, as it might have changed before the watch got established
+	current, err := withRetry(ctx, func() (*corev1.Pod, error) {
+		return c.ClientSet.CoreV1().
+			Pods(pod.Namespace).
+			Get(ctx, pod.Name, metav1.GetOptions{})
+	})
+	if err != nil {
+		return fmt.Errorf("can not get pod %s: %w", pod.Name, err)
+	}
+
+	for {
+		started, err := spec.PodStartupState(current, runnerContainerName)
+		if err != nil {
+			return err
+		}
+		if started {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("pod %s did not start within %s: %s", pod.Name, c.Config.PodReadyTimeout, spec.PodPendingReason(current))
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return fmt.Errorf("watch for pod %s closed before the pod started: %s", pod.Name, spec.PodPendingReason(current))
+			}
+
+			switch event.Type {
+			case watch.Deleted:
+				return fmt.Errorf("pod %s was deleted before it started", pod.Name)
+			case watch.Error:
+				return fmt.Errorf("watch for pod %s failed: %w", pod.Name, apierrors.FromObject(event.Object))
+			}
+
+			if updatedPod, ok := event.Object.(*corev1.Pod); ok && updatedPod.Name == pod.Name {
+				current = updatedPod
+			}
+		}
+	}
+}
+
+func (c cluster) ensureNamespace(ctx context.Context, runnerNamespace string) error {
+	_, err := withRetry(ctx, func() (*corev1.Namespace, error) {
+		return c.ClientSet.CoreV1().
+			Namespaces().
+			Get(ctx, runnerNamespace, metav1.GetOptions{})
+	})
 	if err != nil && !apierrors.IsNotFound(err) {
 		return err
 	}
@@ -114,11 +390,13 @@ func (p Provider) ensureNamespace(runnerNamespace string) error {
 	// if namespace doesn't exist
 	// there is no need for creating again
 	if apierrors.IsNotFound(err) {
-		_, err = p.ClientSet.CoreV1().Namespaces().Create(context.Background(), &corev1.Namespace{
-			ObjectMeta: metav1.ObjectMeta{
-				Name: runnerNamespace,
-			},
-		}, metav1.CreateOptions{})
+		_, err = withRetry(ctx, func() (*corev1.Namespace, error) {
+			return c.ClientSet.CoreV1().Namespaces().Create(ctx, &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: runnerNamespace,
+				},
+			}, metav1.CreateOptions{})
+		})
 		if err != nil {
 			return err
 		}
@@ -132,6 +410,11 @@ func mergePodSpecs(pod *corev1.Pod, template corev1.PodTemplateSpec) (*corev1.Po
 		return pod, nil
 	}
 
+	// a nil containers field would clear out all containers in the merge
+	if template.Spec.Containers == nil {
+		template.Spec.Containers = []corev1.Container{}
+	}
+
 	patch, _, err := diff.CreateTwoWayMergePatch(pod.Spec, template, corev1.PodTemplateSpec{})
 	if err != nil {
 		return nil, err
@@ -147,92 +430,480 @@ func mergePodSpecs(pod *corev1.Pod, template corev1.PodTemplateSpec) (*corev1.Po
 	return mergedPod, nil
 }
 
-func (p Provider) DeleteInstance(_ context.Context, instance string) error {
-	podName := strings.ToLower(instance)
-	err := p.ClientSet.CoreV1().
-		Pods(config.Config.RunnerNamespace).
-		Delete(context.Background(), podName, metav1.DeleteOptions{})
+func (p Provider) DeleteInstance(ctx context.Context, instance string) error {
+	ctx, cancel := p.withOperationTimeout(ctx)
+	defer cancel()
+
+	c, podName, err := p.clusterForInstance(ctx, instance)
 	if err != nil {
-		// if pod is not found, return nil so garm can delete the instance
-		if apierrors.IsNotFound(err) {
-			return nil
+		return fmt.Errorf("error calling DeleteInstance: %w", err)
+	}
+
+	pod, err := withRetry(ctx, func() (*corev1.Pod, error) {
+		return c.ClientSet.CoreV1().
+			Pods(c.namespace).
+			Get(ctx, podName, metav1.GetOptions{})
+	})
+	if err == nil {
+		err = c.deletePod(ctx, pod, false)
+		// the runner deregisters in the preStop hook, while the pod is terminating
+		if err == nil && len(p.Config.DeregistrationCommand) > 0 {
+			_, err = c.waitForPodsDeleted(ctx, []string{podName}, c.deregistrationTimeout(pod))
 		}
+	}
+	if err != nil && !apierrors.IsNotFound(err) {
 		return fmt.Errorf("error calling DeleteInstance: can not delete instance %s: %w", instance, err)
 	}
+
+	// this includes the parked configmap of a stopped instance
+	err = c.deleteAuxiliaryObjects(ctx, podNameSelector(podName))
+	if err != nil {
+		return fmt.Errorf("error calling DeleteInstance: can not delete auxiliary objects of instance %s: %w", instance, err)
+	}
+
+	// if pod is not found, return nil so garm can delete the instance
 	return nil
 }
 
-func (p Provider) GetInstance(_ context.Context, instance string) (params.ProviderInstance, error) {
-	podName := strings.ToLower(instance)
+func (p Provider) GetInstance(ctx context.Context, instance string) (params.ProviderInstance, error) {
+	ctx, cancel := p.withOperationTimeout(ctx)
+	defer cancel()
 
-	pod, err := p.ClientSet.CoreV1().
-		Pods(config.Config.RunnerNamespace).
-		Get(context.Background(), podName, metav1.GetOptions{})
+	c, podName, err := p.clusterForInstance(ctx, instance)
+	if err != nil {
+		return params.ProviderInstance{}, fmt.Errorf("error calling GetInstance: %w", err)
+	}
+
+	pod, err := withRetry(ctx, func() (*corev1.Pod, error) {
+		return c.ClientSet.CoreV1().
+			Pods(c.namespace).
+			Get(ctx, podName, metav1.GetOptions{})
+	})
+	if apierrors.IsNotFound(err) {
+		parkedConfigMap, parkedErr := withRetry(ctx, func() (*corev1.ConfigMap, error) {
+			return c.ClientSet.CoreV1().
+				ConfigMaps(c.namespace).
+				Get(ctx, podName, metav1.GetOptions{})
+		})
+		if parkedErr == nil && parkedConfigMap.Labels[spec.GarmStoppedLabel] == "true" {
+			return c.parkedToInstance(parkedConfigMap)
+		}
+	}
 	if err != nil {
 		return params.ProviderInstance{}, fmt.Errorf("error calling GetInstance: can not get instance %s: %s", instance, err)
 	}
 
-	result, err := spec.PodToInstance(pod, "")
+	result, err := c.podToInstance(pod, "")
 	if err != nil {
 		return params.ProviderInstance{}, err
 	}
 
+	if spec.IsUnhealthy(result) {
+		events, err := c.listWarningEvents(ctx, pod.Name)
+		if err != nil {
+			slog.Error(fmt.Sprintf("Error listing events of pod: %v in namespace %v: %v", pod.Name, pod.Namespace, err))
+		}
+		spec.AppendEventsToProviderFault(result, pod, events)
+	}
+
 	return *result, nil
 }
 
-func (p Provider) ListInstances(_ context.Context, _ string) ([]params.ProviderInstance, error) {
-	pods, err := p.ClientSet.
-		CoreV1().
-		Pods(config.Config.RunnerNamespace).
-		List(context.Background(), metav1.ListOptions{
-			LabelSelector: p.LabelSelector.String(),
-		})
+func (p Provider) ListInstances(ctx context.Context, _ string) ([]params.ProviderInstance, error) {
+	ctx, cancel := p.withOperationTimeout(ctx)
+	defer cancel()
+
+	result := []params.ProviderInstance{}
+	for _, c := range p.allClusters() {
+		instances, err := c.listInstances(ctx)
+		if err != nil {
+			return []params.ProviderInstance{}, err
+		}
+		result = append(result, instances...)
+	}
+	return result, nil
+}
+
+func (c cluster) listInstances(ctx context.Context) ([]params.ProviderInstance, error) {
+	pods, err := withRetry(ctx, func() (*corev1.PodList, error) {
+		return c.ClientSet.
+			CoreV1().
+			Pods(c.namespace).
+			List(ctx, metav1.ListOptions{
+				LabelSelector: c.LabelSelector.String(),
+			})
+	})
 	if err != nil {
 		return []params.ProviderInstance{}, fmt.Errorf("could not list pods: %w", err)
 	}
-	result := make([]params.ProviderInstance, len(pods.Items))
-	for i, item := range pods.Items {
-		pod := item
-		instance, err := spec.PodToInstance(&pod, "")
+
+	instances := make([]*params.ProviderInstance, len(pods.Items))
+	faulty := false
+	for i := range pods.Items {
+		instance, err := c.podToInstance(&pods.Items[i], "")
+		if err != nil {
+			return []params.ProviderInstance{}, err
+		}
+		instances[i] = instance
+		faulty = faulty || spec.HasFault(instance)
+	}
+
+	// the events of all pods are listed at once and only if a pod has a fault,
+	// pods which are just starting up don't get events
+	eventsByPod := map[string][]corev1.Event{}
+	if faulty {
+		events, err := c.listWarningEvents(ctx, "")
+		if err != nil {
+			slog.Error(fmt.Sprintf("Error listing events in namespace %v: %v", c.namespace, err))
+		}
+		for _, event := range events {
+			eventsByPod[event.InvolvedObject.Name] = append(eventsByPod[event.InvolvedObject.Name], event)
+		}
+	}
+
+	result := make([]params.ProviderInstance, 0, len(pods.Items))
+	podNames := make(map[string]bool, len(pods.Items))
+	for i, instance := range instances {
+		pod := &pods.Items[i]
+		if spec.HasFault(instance) {
+			spec.AppendEventsToProviderFault(instance, pod, eventsByPod[pod.Name])
+		}
+		result = append(result, *instance)
+		podNames[pod.Name] = true
+	}
+
+	parkedConfigMaps, err := c.listParkedConfigMaps(ctx)
+	if err != nil {
+		return []params.ProviderInstance{}, fmt.Errorf("could not list stopped instances: %w", err)
+	}
+	for i := range parkedConfigMaps.Items {
+		// a pod which is already running again takes precedence
+		if podNames[parkedConfigMaps.Items[i].Name] {
+			continue
+		}
+		instance, err := c.parkedToInstance(&parkedConfigMaps.Items[i])
 		if err != nil {
 			return []params.ProviderInstance{}, err
 		}
-		result[i] = *instance
+		result = append(result, instance)
 	}
 	return result, nil
 }
 
-func (p Provider) RemoveAllInstances(_ context.Context) error {
-	pods, err := p.ClientSet.
-		CoreV1().
-		Pods(config.Config.RunnerNamespace).
-		List(context.Background(), metav1.ListOptions{
-			LabelSelector: p.LabelSelector.String(),
-		})
+func (p Provider) RemoveAllInstances(ctx context.Context) error {
+	ctx, cancel := p.withOperationTimeout(ctx)
+	defer cancel()
+
+	var errs []error
+	for _, c := range p.allClusters() {
+		if err := c.removeAllInstances(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c cluster) removeAllInstances(ctx context.Context) error {
+	pods, err := withRetry(ctx, func() (*corev1.PodList, error) {
+		return c.ClientSet.
+			CoreV1().
+			Pods(c.namespace).
+			List(ctx, metav1.ListOptions{
+				LabelSelector: c.LabelSelector.String(),
+			})
+	})
 	if err != nil {
 		return err
 	}
 
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		errs    []error
+		deleted []string
+		// pods which still exist keep their auxiliary objects
+		keep = map[string]bool{}
+	)
+	sem := make(chan struct{}, c.deleteConcurrency())
 	for _, pod := range pods.Items {
-		err := p.ClientSet.CoreV1().
-			Pods(config.Config.RunnerNamespace).
-			Delete(context.Background(), pod.Name, metav1.DeleteOptions{})
-		if err != nil {
-			slog.Error(fmt.Sprintf("Error deleting pod: %v in namespace %v", pod.Name, pod.Namespace))
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(pod *corev1.Pod) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			err := c.deletePod(ctx, pod, false)
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case apierrors.IsNotFound(err):
+				// the pod is already gone
+			case err != nil:
+				errs = append(errs, fmt.Errorf("can not delete pod %s in namespace %s: %w", pod.Name, c.namespace, err))
+				keep[pod.Name] = true
+			default:
+				deleted = append(deleted, pod.Name)
+			}
+		}(&pod)
+	}
+	wg.Wait()
+
+	remaining, err := c.waitForPodsDeleted(ctx, deleted, c.deleteTimeout())
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for _, podName := range remaining {
+		keep[podName] = true
+	}
+
+	// objects of failed creates and stopped instances are left over without a pod
+	c.sweepAuxiliaryObjects(ctx, keep)
+	return errors.Join(errs...)
+}
+
+// waitForPodsDeleted waits until none of the given pods exist anymore,
+// as deleted pods might still be terminating. The pods which still exist are returned.
+func (c cluster) waitForPodsDeleted(ctx context.Context, podNames []string, timeout time.Duration) ([]string, error) {
+	if len(podNames) == 0 {
+		return nil, nil
+	}
+
+	remaining := map[string]bool{}
+	for _, podName := range podNames {
+		remaining[podName] = true
+	}
+
+	// the pods are checked by name, as the pool of an instance is not known to every command
+	err := wait.PollUntilContextTimeout(ctx, deletePollInterval, timeout, true, func(ctx context.Context) (bool, error) {
+		for podName := range remaining {
+			_, err := c.ClientSet.CoreV1().
+				Pods(c.namespace).
+				Get(ctx, podName, metav1.GetOptions{})
+			switch {
+			case apierrors.IsNotFound(err):
+				delete(remaining, podName)
+			case err != nil && !isRetriable(err):
+				return false, err
+			}
+			// transient errors are retried by the next poll
+		}
+		return len(remaining) == 0, nil
+	})
+
+	names := make([]string, 0, len(remaining))
+	for podName := range remaining {
+		names = append(names, podName)
+	}
+	sort.Strings(names)
+
+	switch {
+	case wait.Interrupted(err):
+		return names, fmt.Errorf("pods %s in namespace %s are not gone within %s: %w", strings.Join(names, ", "), c.namespace, timeout, err)
+	case err != nil:
+		return names, fmt.Errorf("can not check if pods %s in namespace %s are gone: %w", strings.Join(names, ", "), c.namespace, err)
+	}
+	return nil, nil
+}
+
+// Stop parks the runner pod in a configmap and deletes the pod afterwards.
+// The pod is recreated from the spec persisted at creation time on Start.
+func (p Provider) Stop(ctx context.Context, instance string, force bool) error {
+	ctx, cancel := p.withOperationTimeout(ctx)
+	defer cancel()
+
+	c, podName, err := p.clusterForInstance(ctx, instance)
+	if err != nil {
+		return fmt.Errorf("error calling Stop: %w", err)
+	}
+
+	pod, err := withRetry(ctx, func() (*corev1.Pod, error) {
+		return c.ClientSet.CoreV1().
+			Pods(c.namespace).
+			Get(ctx, podName, metav1.GetOptions{})
+	})
+	if err != nil {
+		if apierrors.IsNotFound(err) && c.isParked(ctx, podName) {
+			return nil
+		}
+		return fmt.Errorf("error calling Stop: can not get instance %s: %w", instance, err)
+	}
+
+	desiredConfigMap, err := spec.PodToParkedConfigMap(pod)
+	if err != nil {
+		return fmt.Errorf("error calling Stop: %w", err)
+	}
+
+	parkedConfigMap, err := withRetry(ctx, func() (*corev1.ConfigMap, error) {
+		return c.ClientSet.CoreV1().
+			ConfigMaps(c.namespace).
+			Create(ctx, desiredConfigMap, metav1.CreateOptions{})
+	})
+	if apierrors.IsAlreadyExists(err) {
+		parkedConfigMap, err = withRetry(ctx, func() (*corev1.ConfigMap, error) {
+			return c.ClientSet.CoreV1().
+				ConfigMaps(c.namespace).
+				Update(ctx, desiredConfigMap, metav1.UpdateOptions{})
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("error calling Stop: can not park instance %s: %w", instance, err)
+	}
+
+	// keep the auxiliary objects while the pod is gone
+	err = c.adoptAuxiliaryObjects(ctx, podName, spec.OwnerReference(parkedConfigMap, "ConfigMap"))
+	if err != nil {
+		return fmt.Errorf("error calling Stop: %w", err)
+	}
+
+	err = c.deletePod(ctx, pod, force)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("error calling Stop: can not delete pod of instance %s: %w", instance, err)
+	}
+
+	return nil
+}
+
+// Start recreates the runner pod of a stopped instance from its parked configmap.
+func (p Provider) Start(ctx context.Context, instance string) error {
+	ctx, cancel := p.withOperationTimeout(ctx)
+	defer cancel()
+
+	c, podName, err := p.clusterForInstance(ctx, instance)
+	if err != nil {
+		return fmt.Errorf("error calling Start: %w", err)
+	}
+
+	parkedConfigMap, err := withRetry(ctx, func() (*corev1.ConfigMap, error) {
+		return c.ClientSet.CoreV1().
+			ConfigMaps(c.namespace).
+			Get(ctx, podName, metav1.GetOptions{})
+	})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			// instance is not stopped, nothing to do if the pod is still around
+			_, err = withRetry(ctx, func() (*corev1.Pod, error) {
+				return c.ClientSet.CoreV1().
+					Pods(c.namespace).
+					Get(ctx, podName, metav1.GetOptions{})
+			})
+			if err == nil {
+				return nil
+			}
 		}
+		return fmt.Errorf("error calling Start: can not get stopped instance %s: %w", instance, err)
+	}
+
+	pod, err := spec.ParkedConfigMapToPod(parkedConfigMap)
+	if err != nil {
+		return fmt.Errorf("error calling Start: %w", err)
 	}
+
+	startedPod, err := withRetry(ctx, func() (*corev1.Pod, error) {
+		return c.ClientSet.CoreV1().
+			Pods(c.namespace).
+			Create(ctx, pod, metav1.CreateOptions{})
+	})
+	if apierrors.IsAlreadyExists(err) {
+		startedPod, err = withRetry(ctx, func() (*corev1.Pod, error) {
+			return c.ClientSet.CoreV1().
+				Pods(c.namespace).
+				Get(ctx, pod.Name, metav1.GetOptions{})
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("error calling Start: can not create pod %s: %w", pod.Name, err)
+	}
+
+	// hand the auxiliary objects back to the pod before the parked configmap gets deleted
+	err = c.adoptAuxiliaryObjects(ctx, startedPod.Name, spec.OwnerReference(startedPod, "Pod"))
+	if err != nil {
+		return fmt.Errorf("error calling Start: %w", err)
+	}
+
+	err = retryOnError(ctx, func() error {
+		return c.ClientSet.CoreV1().
+			ConfigMaps(c.namespace).
+			Delete(ctx, parkedConfigMap.Name, metav1.DeleteOptions{})
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("error calling Start: can not delete stopped instance %s: %w", instance, err)
+	}
+
 	return nil
 }
 
-func (p Provider) Stop(_ context.Context, instance string, force bool) error {
-	panic(fmt.Sprintf("Stop() not implemented, called with instance: %s, force: %t", instance, force))
+// listWarningEvents lists the warning events of pods in the runner namespace.
+// If podName is set, only the events of the given pod are listed.
+func (c cluster) listWarningEvents(ctx context.Context, podName string) ([]corev1.Event, error) {
+	selector := fields.Set{
+		"involvedObject.kind": "Pod",
+		"type":                corev1.EventTypeWarning,
+	}
+	if podName != "" {
+		selector["involvedObject.name"] = podName
+	}
+
+	events, err := withRetry(ctx, func() (*corev1.EventList, error) {
+		return c.ClientSet.
+			CoreV1().
+			Events(c.namespace).
+			List(ctx, metav1.ListOptions{
+				FieldSelector: selector.AsSelector().String(),
+			})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events.Items, nil
 }
 
-func (p Provider) Start(_ context.Context, instance string) error {
-	panic(fmt.Sprintf("Start() not implemented, called with instance: %s", instance))
+func (c cluster) isParked(ctx context.Context, name string) bool {
+	configMap, err := withRetry(ctx, func() (*corev1.ConfigMap, error) {
+		return c.ClientSet.CoreV1().
+			ConfigMaps(c.namespace).
+			Get(ctx, name, metav1.GetOptions{})
+	})
+	return err == nil && configMap.Labels[spec.GarmStoppedLabel] == "true"
 }
 
-func NewKubernetesProvider(clientSet kubernetes.Interface, controllerID, poolID string) (*Provider, error) {
+// listParkedConfigMaps lists the parked configmaps of the pool matching the given additional requirements
+func (c cluster) listParkedConfigMaps(ctx context.Context, requirements ...labels.Requirement) (*corev1.ConfigMapList, error) {
+	stopped, err := labels.NewRequirement(spec.GarmStoppedLabel, selection.Equals, []string{"true"})
+	if err != nil {
+		return nil, err
+	}
+	requirements = append(requirements, *stopped)
+
+	return withRetry(ctx, func() (*corev1.ConfigMapList, error) {
+		return c.ClientSet.
+			CoreV1().
+			ConfigMaps(c.namespace).
+			List(ctx, metav1.ListOptions{
+				LabelSelector: c.LabelSelector.Add(requirements...).String(),
+			})
+	})
+}
+
+func (c cluster) parkedToInstance(configMap *corev1.ConfigMap) (params.ProviderInstance, error) {
+	pod, err := spec.ParkedConfigMapToPod(configMap)
+	if err != nil {
+		return params.ProviderInstance{}, err
+	}
+
+	result, err := c.podToInstance(pod, params.InstanceStopped)
+	if err != nil {
+		return params.ProviderInstance{}, err
+	}
+
+	return *result, nil
+}
+
+func NewKubernetesProvider(cfg *config.ProviderConfig, clientSet kubernetes.Interface, controllerID, poolID string, clusters ...Cluster) (*Provider, error) {
+	if cfg == nil {
+		return nil, errors.New("no provider config given")
+	}
+
 	labelSelector, err := metav1.LabelSelectorAsSelector(&metav1.LabelSelector{
 		MatchLabels: map[string]string{
 			spec.GarmControllerIDLabel: controllerID,
@@ -246,5 +917,7 @@ func NewKubernetesProvider(clientSet kubernetes.Interface, controllerID, poolID
 		ControllerID:  controllerID,
 		ClientSet:     clientSet,
 		LabelSelector: labelSelector,
+		Clusters:      clusters,
+		Config:        cfg,
 	}, nil
 }
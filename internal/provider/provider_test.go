@@ -4,17 +4,25 @@ package provider_test
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/cloudbase/garm-provider-common/params"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/utils/ptr"
 
 	"github.com/mercedes-benz/garm-provider-k8s/internal/provider"
 	"github.com/mercedes-benz/garm-provider-k8s/internal/spec"
@@ -215,8 +223,15 @@ func TestCreateInstance(t *testing.T) {
 									Value: "https://metadata.test",
 								},
 								{
-									Name:  "BEARER_TOKEN",
-									Value: "test-token",
+									Name: "BEARER_TOKEN",
+									ValueFrom: &corev1.EnvVarSource{
+										SecretKeyRef: &corev1.SecretKeySelector{
+											LocalObjectReference: corev1.LocalObjectReference{
+												Name: providerID + "-credentials",
+											},
+											Key: "BEARER_TOKEN",
+										},
+									},
 								},
 								{
 									Name:  "CALLBACK_URL",
@@ -418,8 +433,15 @@ func TestCreateInstance(t *testing.T) {
 									Value: "https://metadata.test",
 								},
 								{
-									Name:  "BEARER_TOKEN",
-									Value: "test-token",
+									Name: "BEARER_TOKEN",
+									ValueFrom: &corev1.EnvVarSource{
+										SecretKeyRef: &corev1.SecretKeySelector{
+											LocalObjectReference: corev1.LocalObjectReference{
+												Name: providerID + "-credentials",
+											},
+											Key: "BEARER_TOKEN",
+										},
+									},
 								},
 								{
 									Name:  "CALLBACK_URL",
@@ -587,8 +609,15 @@ func TestCreateInstance(t *testing.T) {
 									Value: "https://metadata.test",
 								},
 								{
-									Name:  "BEARER_TOKEN",
-									Value: "test-token",
+									Name: "BEARER_TOKEN",
+									ValueFrom: &corev1.EnvVarSource{
+										SecretKeyRef: &corev1.SecretKeySelector{
+											LocalObjectReference: corev1.LocalObjectReference{
+												Name: providerID + "-credentials",
+											},
+											Key: "BEARER_TOKEN",
+										},
+									},
 								},
 								{
 									Name:  "CALLBACK_URL",
@@ -616,48 +645,29 @@ func TestCreateInstance(t *testing.T) {
 			err:            nil,
 		},
 		{
-			name: "Valid bootstrapParams and merge pod template spec with livenessProbe",
+			name: "Valid bootstrapParams and pool specific pod template spec from extra_specs",
 			config: &config.ProviderConfig{
 				KubeConfigPath:  "",
 				RunnerNamespace: "runner",
 				PodTemplate: corev1.PodTemplateSpec{
 					Spec: corev1.PodSpec{
-						Containers: []corev1.Container{
-							{
-								Name: "runner",
-								LivenessProbe: &corev1.Probe{
-									ProbeHandler: corev1.ProbeHandler{
-										Exec: &corev1.ExecAction{
-											Command: []string{
-												"/bin/sh",
-												"-c",
-												"test -f /tmp/healthy",
-											},
-										},
-									},
-									InitialDelaySeconds:           5,
-									TimeoutSeconds:                5,
-									PeriodSeconds:                 1,
-									TerminationGracePeriodSeconds: nil,
-								},
-							},
-						},
+						Containers: []corev1.Container{},
 					},
 				},
 			},
 			bootstrapParams: params.BootstrapInstance{
-				Name:             instanceName,
-				PoolID:           poolID,
-				Flavor:           "small",
-				RepoURL:          "https://github.com/testorg",
-				InstanceToken:    "test-token",
-				MetadataURL:      "https://metadata.test",
-				CallbackURL:      "https://callback.test/status",
-				Image:            "localhost:5000/runner:ubuntu-22.04",
-				OSType:           "linux",
-				OSArch:           "arm64",
-				Labels:           []string{"road-runner", "linux", "arm64", "kubernetes"},
-				JitConfigEnabled: true,
+				Name:          instanceName,
+				PoolID:        poolID,
+				Flavor:        "small",
+				RepoURL:       "https://github.com/testorg",
+				InstanceToken: "test-token",
+				MetadataURL:   "https://metadata.test",
+				CallbackURL:   "https://callback.test/status",
+				Image:         "localhost:5000/runner:ubuntu-22.04",
+				OSType:        "linux",
+				OSArch:        "arm64",
+				Labels:        []string{"road-runner", "linux", "arm64", "kubernetes"},
+				ExtraSpecs:    []byte(`{"podTemplate":{"spec":{"nodeSelector":{"kubernetes.io/arch":"arm64"},"containers":[{"name":"runner","env":[{"name":"POOL_ENV","value":"pool"}]}]}}}`),
 			},
 			expectedProviderInstance: params.ProviderInstance{
 				ProviderID: providerID,
@@ -680,6 +690,8 @@ func TestCreateInstance(t *testing.T) {
 						spec.GarmInstanceNameLabel: instanceName,
 						spec.GarmFlavorLabel:       "small",
 						spec.GarmOSArchLabel:       "arm64",
+						spec.GarmOSNameLabel:       "",
+						spec.GarmOSVersionLabel:    "",
 						spec.GarmOSTypeLabel:       "linux",
 						spec.GarmPoolIDLabel:       "ddce45e7-1bbb-4ecd-92cb-c733372b5cde",
 						spec.GarmControllerIDLabel: controllerID,
@@ -687,6 +699,9 @@ func TestCreateInstance(t *testing.T) {
 					},
 				},
 				Spec: corev1.PodSpec{
+					NodeSelector: map[string]string{
+						"kubernetes.io/arch": "arm64",
+					},
 					Volumes: []corev1.Volume{
 						{
 							Name: "runner",
@@ -704,6 +719,10 @@ func TestCreateInstance(t *testing.T) {
 							Name:  "runner",
 							Image: "localhost:5000/runner:ubuntu-22.04",
 							Env: []corev1.EnvVar{
+								{
+									Name:  "POOL_ENV",
+									Value: "pool",
+								},
 								{
 									Name:  "RUNNER_ORG",
 									Value: "testorg",
@@ -757,8 +776,15 @@ func TestCreateInstance(t *testing.T) {
 									Value: "https://metadata.test",
 								},
 								{
-									Name:  "BEARER_TOKEN",
-									Value: "test-token",
+									Name: "BEARER_TOKEN",
+									ValueFrom: &corev1.EnvVarSource{
+										SecretKeyRef: &corev1.SecretKeySelector{
+											LocalObjectReference: corev1.LocalObjectReference{
+												Name: providerID + "-credentials",
+											},
+											Key: "BEARER_TOKEN",
+										},
+									},
 								},
 								{
 									Name:  "CALLBACK_URL",
@@ -766,7 +792,7 @@ func TestCreateInstance(t *testing.T) {
 								},
 								{
 									Name:  "JIT_CONFIG_ENABLED",
-									Value: "true",
+									Value: "false",
 								},
 							},
 							VolumeMounts: []corev1.VolumeMount{
@@ -776,23 +802,8 @@ func TestCreateInstance(t *testing.T) {
 									MountPath: "/runner",
 								},
 							},
-							ImagePullPolicy: "Always",
+							ImagePullPolicy: corev1.PullAlways,
 							Resources:       corev1.ResourceRequirements{},
-							LivenessProbe: &corev1.Probe{
-								ProbeHandler: corev1.ProbeHandler{
-									Exec: &corev1.ExecAction{
-										Command: []string{
-											"/bin/sh",
-											"-c",
-											"test -f /tmp/healthy",
-										},
-									},
-								},
-								InitialDelaySeconds:           5,
-								TimeoutSeconds:                5,
-								PeriodSeconds:                 1,
-								TerminationGracePeriodSeconds: nil,
-							},
 						},
 					},
 				},
@@ -801,35 +812,41 @@ func TestCreateInstance(t *testing.T) {
 			err:            nil,
 		},
 		{
-			name: "Valid bootstrapParams and merge pod template spec with additional labels",
+			name: "Valid bootstrapParams and named pod template spec referenced from extra_specs",
 			config: &config.ProviderConfig{
 				KubeConfigPath:  "",
 				RunnerNamespace: "runner",
 				PodTemplate: corev1.PodTemplateSpec{
-					ObjectMeta: metav1.ObjectMeta{
-						Labels: map[string]string{
-							"foo":  "bar",
-							"foo1": "bar2",
-						},
-					},
 					Spec: corev1.PodSpec{
 						Containers: []corev1.Container{},
 					},
 				},
+				PodTemplates: map[string]corev1.PodTemplateSpec{
+					"dind": {
+						Spec: corev1.PodSpec{
+							Containers: []corev1.Container{
+								{
+									Name:  "docker",
+									Image: "docker:dind",
+								},
+							},
+						},
+					},
+				},
 			},
 			bootstrapParams: params.BootstrapInstance{
-				Name:             instanceName,
-				PoolID:           poolID,
-				Flavor:           "small",
-				RepoURL:          "https://github.com/testorg",
-				InstanceToken:    "test-token",
-				MetadataURL:      "https://metadata.test",
-				CallbackURL:      "https://callback.test/status",
-				Image:            "localhost:5000/runner:ubuntu-22.04",
-				OSType:           "linux",
-				OSArch:           "arm64",
-				Labels:           []string{"road-runner", "linux", "arm64", "kubernetes"},
-				JitConfigEnabled: true,
+				Name:          instanceName,
+				PoolID:        poolID,
+				Flavor:        "small",
+				RepoURL:       "https://github.com/testorg",
+				InstanceToken: "test-token",
+				MetadataURL:   "https://metadata.test",
+				CallbackURL:   "https://callback.test/status",
+				Image:         "localhost:5000/runner:ubuntu-22.04",
+				OSType:        "linux",
+				OSArch:        "arm64",
+				Labels:        []string{"road-runner", "linux", "arm64", "kubernetes"},
+				ExtraSpecs:    []byte(`{"podTemplateName":"dind"}`),
 			},
 			expectedProviderInstance: params.ProviderInstance{
 				ProviderID: providerID,
@@ -852,12 +869,12 @@ func TestCreateInstance(t *testing.T) {
 						spec.GarmInstanceNameLabel: instanceName,
 						spec.GarmFlavorLabel:       "small",
 						spec.GarmOSArchLabel:       "arm64",
+						spec.GarmOSNameLabel:       "",
+						spec.GarmOSVersionLabel:    "",
 						spec.GarmOSTypeLabel:       "linux",
 						spec.GarmPoolIDLabel:       "ddce45e7-1bbb-4ecd-92cb-c733372b5cde",
 						spec.GarmControllerIDLabel: controllerID,
 						spec.GarmRunnerGroupLabel:  "",
-						"foo":                      "bar",
-						"foo1":                     "bar2",
 					},
 				},
 				Spec: corev1.PodSpec{
@@ -874,6 +891,10 @@ func TestCreateInstance(t *testing.T) {
 					},
 					RestartPolicy: corev1.RestartPolicyNever,
 					Containers: []corev1.Container{
+						{
+							Name:  "docker",
+							Image: "docker:dind",
+						},
 						{
 							Name:  "runner",
 							Image: "localhost:5000/runner:ubuntu-22.04",
@@ -931,8 +952,15 @@ func TestCreateInstance(t *testing.T) {
 									Value: "https://metadata.test",
 								},
 								{
-									Name:  "BEARER_TOKEN",
-									Value: "test-token",
+									Name: "BEARER_TOKEN",
+									ValueFrom: &corev1.EnvVarSource{
+										SecretKeyRef: &corev1.SecretKeySelector{
+											LocalObjectReference: corev1.LocalObjectReference{
+												Name: providerID + "-credentials",
+											},
+											Key: "BEARER_TOKEN",
+										},
+									},
 								},
 								{
 									Name:  "CALLBACK_URL",
@@ -940,7 +968,7 @@ func TestCreateInstance(t *testing.T) {
 								},
 								{
 									Name:  "JIT_CONFIG_ENABLED",
-									Value: "true",
+									Value: "false",
 								},
 							},
 							VolumeMounts: []corev1.VolumeMount{
@@ -950,7 +978,7 @@ func TestCreateInstance(t *testing.T) {
 									MountPath: "/runner",
 								},
 							},
-							ImagePullPolicy: "Always",
+							ImagePullPolicy: corev1.PullAlways,
 							Resources:       corev1.ResourceRequirements{},
 						},
 					},
@@ -960,68 +988,37 @@ func TestCreateInstance(t *testing.T) {
 			err:            nil,
 		},
 		{
-			name: "Valid bootstrapParams and custom flavors",
+			name: "Valid bootstrapParams and named pod template spec matching the flavor",
 			config: &config.ProviderConfig{
 				KubeConfigPath:  "",
 				RunnerNamespace: "runner",
 				PodTemplate: corev1.PodTemplateSpec{
 					Spec: corev1.PodSpec{
-						Containers: []corev1.Container{
-							{
-								Name: "runner",
-								LivenessProbe: &corev1.Probe{
-									ProbeHandler: corev1.ProbeHandler{
-										Exec: &corev1.ExecAction{
-											Command: []string{
-												"/bin/sh",
-												"-c",
-												"test -f /tmp/healthy",
-											},
-										},
-									},
-									InitialDelaySeconds:           5,
-									TimeoutSeconds:                5,
-									PeriodSeconds:                 1,
-									TerminationGracePeriodSeconds: nil,
-								},
-							},
-						},
+						Containers: []corev1.Container{},
 					},
 				},
-				Flavors: map[string]corev1.ResourceRequirements{
-					"tiny": {
-						Limits: corev1.ResourceList{
-							corev1.ResourceMemory: resource.MustParse("200Mi"),
-						},
-						Requests: corev1.ResourceList{
-							corev1.ResourceCPU:    resource.MustParse("100m"),
-							corev1.ResourceMemory: resource.MustParse("100Mi"),
-						},
-					},
-					"ultra": {
-						Limits: corev1.ResourceList{
-							corev1.ResourceMemory: resource.MustParse("1Gi"),
-						},
-						Requests: corev1.ResourceList{
-							corev1.ResourceCPU:    resource.MustParse("1000m"),
-							corev1.ResourceMemory: resource.MustParse("500Mi"),
+				PodTemplates: map[string]corev1.PodTemplateSpec{
+					"small": {
+						Spec: corev1.PodSpec{
+							NodeSelector: map[string]string{
+								"node-role": "lightweight",
+							},
 						},
 					},
 				},
 			},
 			bootstrapParams: params.BootstrapInstance{
-				Name:             instanceName,
-				PoolID:           poolID,
-				Flavor:           "ultra",
-				RepoURL:          "https://github.com/testorg",
-				InstanceToken:    "test-token",
-				MetadataURL:      "https://metadata.test",
-				CallbackURL:      "https://callback.test/status",
-				Image:            "localhost:5000/runner:ubuntu-22.04",
-				OSType:           "linux",
-				OSArch:           "arm64",
-				Labels:           []string{"road-runner", "linux", "arm64", "kubernetes"},
-				JitConfigEnabled: true,
+				Name:          instanceName,
+				PoolID:        poolID,
+				Flavor:        "small",
+				RepoURL:       "https://github.com/testorg",
+				InstanceToken: "test-token",
+				MetadataURL:   "https://metadata.test",
+				CallbackURL:   "https://callback.test/status",
+				Image:         "localhost:5000/runner:ubuntu-22.04",
+				OSType:        "linux",
+				OSArch:        "arm64",
+				Labels:        []string{"road-runner", "linux", "arm64", "kubernetes"},
 			},
 			expectedProviderInstance: params.ProviderInstance{
 				ProviderID: providerID,
@@ -1042,7 +1039,7 @@ func TestCreateInstance(t *testing.T) {
 					Namespace: "runner",
 					Labels: map[string]string{
 						spec.GarmInstanceNameLabel: instanceName,
-						spec.GarmFlavorLabel:       "ultra",
+						spec.GarmFlavorLabel:       "small",
 						spec.GarmOSArchLabel:       "arm64",
 						spec.GarmOSTypeLabel:       "linux",
 						spec.GarmPoolIDLabel:       "ddce45e7-1bbb-4ecd-92cb-c733372b5cde",
@@ -1051,6 +1048,9 @@ func TestCreateInstance(t *testing.T) {
 					},
 				},
 				Spec: corev1.PodSpec{
+					NodeSelector: map[string]string{
+						"node-role": "lightweight",
+					},
 					Volumes: []corev1.Volume{
 						{
 							Name: "runner",
@@ -1121,8 +1121,15 @@ func TestCreateInstance(t *testing.T) {
 									Value: "https://metadata.test",
 								},
 								{
-									Name:  "BEARER_TOKEN",
-									Value: "test-token",
+									Name: "BEARER_TOKEN",
+									ValueFrom: &corev1.EnvVarSource{
+										SecretKeyRef: &corev1.SecretKeySelector{
+											LocalObjectReference: corev1.LocalObjectReference{
+												Name: providerID + "-credentials",
+											},
+											Key: "BEARER_TOKEN",
+										},
+									},
 								},
 								{
 									Name:  "CALLBACK_URL",
@@ -1130,7 +1137,7 @@ func TestCreateInstance(t *testing.T) {
 								},
 								{
 									Name:  "JIT_CONFIG_ENABLED",
-									Value: "true",
+									Value: "false",
 								},
 							},
 							VolumeMounts: []corev1.VolumeMount{
@@ -1140,31 +1147,8 @@ func TestCreateInstance(t *testing.T) {
 									MountPath: "/runner",
 								},
 							},
-							ImagePullPolicy: "Always",
-							Resources: corev1.ResourceRequirements{
-								Limits: corev1.ResourceList{
-									corev1.ResourceMemory: resource.MustParse("1Gi"),
-								},
-								Requests: corev1.ResourceList{
-									corev1.ResourceCPU:    resource.MustParse("1"),
-									corev1.ResourceMemory: resource.MustParse("500Mi"),
-								},
-							},
-							LivenessProbe: &corev1.Probe{
-								ProbeHandler: corev1.ProbeHandler{
-									Exec: &corev1.ExecAction{
-										Command: []string{
-											"/bin/sh",
-											"-c",
-											"test -f /tmp/healthy",
-										},
-									},
-								},
-								InitialDelaySeconds:           5,
-								TimeoutSeconds:                5,
-								PeriodSeconds:                 1,
-								TerminationGracePeriodSeconds: nil,
-							},
+							ImagePullPolicy: corev1.PullAlways,
+							Resources:       corev1.ResourceRequirements{},
 						},
 					},
 				},
@@ -1173,46 +1157,29 @@ func TestCreateInstance(t *testing.T) {
 			err:            nil,
 		},
 		{
-			name: "Overwrite default runner emptyDir volume with a PVC",
+			name: "Valid bootstrapParams and merge pod template spec with livenessProbe",
 			config: &config.ProviderConfig{
 				KubeConfigPath:  "",
 				RunnerNamespace: "runner",
 				PodTemplate: corev1.PodTemplateSpec{
 					Spec: corev1.PodSpec{
-						Volumes: []corev1.Volume{
+						Containers: []corev1.Container{
 							{
 								Name: "runner",
-								VolumeSource: corev1.VolumeSource{
-									Ephemeral: &corev1.EphemeralVolumeSource{
-										VolumeClaimTemplate: &corev1.PersistentVolumeClaimTemplate{
-											Spec: corev1.PersistentVolumeClaimSpec{
-												AccessModes: []corev1.PersistentVolumeAccessMode{
-													corev1.ReadWriteOnce,
-												},
-												StorageClassName: toPointer("cinder"),
-												Resources: corev1.VolumeResourceRequirements{
-													Requests: corev1.ResourceList{
-														corev1.ResourceStorage: resource.MustParse("1Gi"),
-													},
-												},
+								LivenessProbe: &corev1.Probe{
+									ProbeHandler: corev1.ProbeHandler{
+										Exec: &corev1.ExecAction{
+											Command: []string{
+												"/bin/sh",
+												"-c",
+												"test -f /tmp/healthy",
 											},
 										},
 									},
-								},
-							},
-						},
-						Containers: []corev1.Container{
-							{
-								Name: "runner",
-								Resources: corev1.ResourceRequirements{
-									Limits: corev1.ResourceList{
-										corev1.ResourceCPU:    resource.MustParse("500m"),
-										corev1.ResourceMemory: resource.MustParse("500Mi"),
-									},
-									Requests: corev1.ResourceList{
-										corev1.ResourceCPU:    resource.MustParse("500m"),
-										corev1.ResourceMemory: resource.MustParse("500Mi"),
-									},
+									InitialDelaySeconds:           5,
+									TimeoutSeconds:                5,
+									PeriodSeconds:                 1,
+									TerminationGracePeriodSeconds: nil,
 								},
 							},
 						},
@@ -1265,20 +1232,9 @@ func TestCreateInstance(t *testing.T) {
 						{
 							Name: "runner",
 							VolumeSource: corev1.VolumeSource{
-								Ephemeral: &corev1.EphemeralVolumeSource{
-									VolumeClaimTemplate: &corev1.PersistentVolumeClaimTemplate{
-										Spec: corev1.PersistentVolumeClaimSpec{
-											AccessModes: []corev1.PersistentVolumeAccessMode{
-												corev1.ReadWriteOnce,
-											},
-											StorageClassName: toPointer("cinder"),
-											Resources: corev1.VolumeResourceRequirements{
-												Requests: corev1.ResourceList{
-													corev1.ResourceStorage: resource.MustParse("1Gi"),
-												},
-											},
-										},
-									},
+								EmptyDir: &corev1.EmptyDirVolumeSource{
+									Medium:    "",
+									SizeLimit: nil,
 								},
 							},
 						},
@@ -1342,8 +1298,15 @@ func TestCreateInstance(t *testing.T) {
 									Value: "https://metadata.test",
 								},
 								{
-									Name:  "BEARER_TOKEN",
-									Value: "test-token",
+									Name: "BEARER_TOKEN",
+									ValueFrom: &corev1.EnvVarSource{
+										SecretKeyRef: &corev1.SecretKeySelector{
+											LocalObjectReference: corev1.LocalObjectReference{
+												Name: providerID + "-credentials",
+											},
+											Key: "BEARER_TOKEN",
+										},
+									},
 								},
 								{
 									Name:  "CALLBACK_URL",
@@ -1362,15 +1325,21 @@ func TestCreateInstance(t *testing.T) {
 								},
 							},
 							ImagePullPolicy: "Always",
-							Resources: corev1.ResourceRequirements{
-								Limits: corev1.ResourceList{
-									corev1.ResourceCPU:    resource.MustParse("500m"),
-									corev1.ResourceMemory: resource.MustParse("500Mi"),
-								},
-								Requests: corev1.ResourceList{
-									corev1.ResourceCPU:    resource.MustParse("500m"),
-									corev1.ResourceMemory: resource.MustParse("500Mi"),
+							Resources:       corev1.ResourceRequirements{},
+							LivenessProbe: &corev1.Probe{
+								ProbeHandler: corev1.ProbeHandler{
+									Exec: &corev1.ExecAction{
+										Command: []string{
+											"/bin/sh",
+											"-c",
+											"test -f /tmp/healthy",
+										},
+									},
 								},
+								InitialDelaySeconds:           5,
+								TimeoutSeconds:                5,
+								PeriodSeconds:                 1,
+								TerminationGracePeriodSeconds: nil,
 							},
 						},
 					},
@@ -1380,57 +1349,20 @@ func TestCreateInstance(t *testing.T) {
 			err:            nil,
 		},
 		{
-			name: "Use new runner volume and corresponding volumemount with custom name",
+			name: "Valid bootstrapParams and merge pod template spec with additional labels",
 			config: &config.ProviderConfig{
 				KubeConfigPath:  "",
 				RunnerNamespace: "runner",
 				PodTemplate: corev1.PodTemplateSpec{
-					Spec: corev1.PodSpec{
-						Volumes: []corev1.Volume{
-							{
-								Name: "runner-vol",
-								VolumeSource: corev1.VolumeSource{
-									Ephemeral: &corev1.EphemeralVolumeSource{
-										VolumeClaimTemplate: &corev1.PersistentVolumeClaimTemplate{
-											Spec: corev1.PersistentVolumeClaimSpec{
-												AccessModes: []corev1.PersistentVolumeAccessMode{
-													corev1.ReadWriteOnce,
-												},
-												StorageClassName: toPointer("cinder"),
-												Resources: corev1.VolumeResourceRequirements{
-													Requests: corev1.ResourceList{
-														corev1.ResourceStorage: resource.MustParse("1Gi"),
-													},
-												},
-											},
-										},
-									},
-								},
-							},
-						},
-						Containers: []corev1.Container{
-							{
-								Name: "runner",
-								Resources: corev1.ResourceRequirements{
-									Limits: corev1.ResourceList{
-										corev1.ResourceCPU:    resource.MustParse("500m"),
-										corev1.ResourceMemory: resource.MustParse("500Mi"),
-									},
-									Requests: corev1.ResourceList{
-										corev1.ResourceCPU:    resource.MustParse("500m"),
-										corev1.ResourceMemory: resource.MustParse("500Mi"),
-									},
-								},
-								VolumeMounts: []corev1.VolumeMount{
-									{
-										Name:      "runner-vol",
-										ReadOnly:  false,
-										MountPath: "/runner",
-									},
-								},
-							},
+					ObjectMeta: metav1.ObjectMeta{
+						Labels: map[string]string{
+							"foo":  "bar",
+							"foo1": "bar2",
 						},
 					},
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{},
+					},
 				},
 			},
 			bootstrapParams: params.BootstrapInstance{
@@ -1472,30 +1404,12 @@ func TestCreateInstance(t *testing.T) {
 						spec.GarmPoolIDLabel:       "ddce45e7-1bbb-4ecd-92cb-c733372b5cde",
 						spec.GarmControllerIDLabel: controllerID,
 						spec.GarmRunnerGroupLabel:  "",
+						"foo":                      "bar",
+						"foo1":                     "bar2",
 					},
 				},
 				Spec: corev1.PodSpec{
 					Volumes: []corev1.Volume{
-						{
-							Name: "runner-vol",
-							VolumeSource: corev1.VolumeSource{
-								Ephemeral: &corev1.EphemeralVolumeSource{
-									VolumeClaimTemplate: &corev1.PersistentVolumeClaimTemplate{
-										Spec: corev1.PersistentVolumeClaimSpec{
-											AccessModes: []corev1.PersistentVolumeAccessMode{
-												corev1.ReadWriteOnce,
-											},
-											StorageClassName: toPointer("cinder"),
-											Resources: corev1.VolumeResourceRequirements{
-												Requests: corev1.ResourceList{
-													corev1.ResourceStorage: resource.MustParse("1Gi"),
-												},
-											},
-										},
-									},
-								},
-							},
-						},
 						{
 							Name: "runner",
 							VolumeSource: corev1.VolumeSource{
@@ -1565,8 +1479,15 @@ func TestCreateInstance(t *testing.T) {
 									Value: "https://metadata.test",
 								},
 								{
-									Name:  "BEARER_TOKEN",
-									Value: "test-token",
+									Name: "BEARER_TOKEN",
+									ValueFrom: &corev1.EnvVarSource{
+										SecretKeyRef: &corev1.SecretKeySelector{
+											LocalObjectReference: corev1.LocalObjectReference{
+												Name: providerID + "-credentials",
+											},
+											Key: "BEARER_TOKEN",
+										},
+									},
 								},
 								{
 									Name:  "CALLBACK_URL",
@@ -1579,22 +1500,13 @@ func TestCreateInstance(t *testing.T) {
 							},
 							VolumeMounts: []corev1.VolumeMount{
 								{
-									Name:      "runner-vol",
+									Name:      "runner",
 									ReadOnly:  false,
 									MountPath: "/runner",
 								},
 							},
 							ImagePullPolicy: "Always",
-							Resources: corev1.ResourceRequirements{
-								Limits: corev1.ResourceList{
-									corev1.ResourceCPU:    resource.MustParse("500m"),
-									corev1.ResourceMemory: resource.MustParse("500Mi"),
-								},
-								Requests: corev1.ResourceList{
-									corev1.ResourceCPU:    resource.MustParse("500m"),
-									corev1.ResourceMemory: resource.MustParse("500Mi"),
-								},
-							},
+							Resources:       corev1.ResourceRequirements{},
 						},
 					},
 				},
@@ -1602,49 +1514,69 @@ func TestCreateInstance(t *testing.T) {
 			runtimeObjects: []runtime.Object{},
 			err:            nil,
 		},
-	}
-
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			// create the provider config
-			config.Config = *tc.config
-
-			// create a fake kubernetes client
-			client := fake.NewSimpleClientset(tc.runtimeObjects...)
-
-			// initialize the provider
-			p, _ := provider.NewKubernetesProvider(client, controllerID, poolID)
-
-			// trigger the instance creation
-			actual, err := p.CreateInstance(context.Background(), tc.bootstrapParams)
-			assert.Equal(t, tc.err, err)
-
-			// get the created pod
-			createdPod, err := client.CoreV1().Pods(config.Config.RunnerNamespace).Get(context.Background(), actual.ProviderID, metav1.GetOptions{})
-			assert.Equal(t, tc.err, err)
-
-			// compare created instance with expected instance
-			assert.Equal(t, tc.expectedProviderInstance, actual)
-
-			// compare created pod with expected pod
-			assert.Equal(t, tc.expectedPodInstance, createdPod)
-		})
-	}
-}
-
-func TestGetInstance(t *testing.T) {
-	testCases := []struct {
-		name                     string
-		config                   *config.ProviderConfig
-		expectedProviderInstance params.ProviderInstance
-		runtimeObjects           []runtime.Object
-		wantErr                  error
-	}{
 		{
-			name: "Get Instance",
+			name: "Valid bootstrapParams and custom flavors",
 			config: &config.ProviderConfig{
 				KubeConfigPath:  "",
 				RunnerNamespace: "runner",
+				PodTemplate: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{
+							{
+								Name: "runner",
+								LivenessProbe: &corev1.Probe{
+									ProbeHandler: corev1.ProbeHandler{
+										Exec: &corev1.ExecAction{
+											Command: []string{
+												"/bin/sh",
+												"-c",
+												"test -f /tmp/healthy",
+											},
+										},
+									},
+									InitialDelaySeconds:           5,
+									TimeoutSeconds:                5,
+									PeriodSeconds:                 1,
+									TerminationGracePeriodSeconds: nil,
+								},
+							},
+						},
+					},
+				},
+				Flavors: map[string]config.Flavor{
+					"tiny": {ResourceRequirements: corev1.ResourceRequirements{
+						Limits: corev1.ResourceList{
+							corev1.ResourceMemory: resource.MustParse("200Mi"),
+						},
+						Requests: corev1.ResourceList{
+							corev1.ResourceCPU:    resource.MustParse("100m"),
+							corev1.ResourceMemory: resource.MustParse("100Mi"),
+						},
+					}},
+					"ultra": {ResourceRequirements: corev1.ResourceRequirements{
+						Limits: corev1.ResourceList{
+							corev1.ResourceMemory: resource.MustParse("1Gi"),
+						},
+						Requests: corev1.ResourceList{
+							corev1.ResourceCPU:    resource.MustParse("1000m"),
+							corev1.ResourceMemory: resource.MustParse("500Mi"),
+						},
+					}},
+				},
+			},
+			bootstrapParams: params.BootstrapInstance{
+				Name:             instanceName,
+				PoolID:           poolID,
+				Flavor:           "ultra",
+				RepoURL:          "https://github.com/testorg",
+				InstanceToken:    "test-token",
+				MetadataURL:      "https://metadata.test",
+				CallbackURL:      "https://callback.test/status",
+				Image:            "localhost:5000/runner:ubuntu-22.04",
+				OSType:           "linux",
+				OSArch:           "arm64",
+				Labels:           []string{"road-runner", "linux", "arm64", "kubernetes"},
+				JitConfigEnabled: true,
 			},
 			expectedProviderInstance: params.ProviderInstance{
 				ProviderID: providerID,
@@ -1655,16 +1587,1963 @@ func TestGetInstance(t *testing.T) {
 				OSArch:     "arm64",
 				Status:     "running",
 			},
-			runtimeObjects: []runtime.Object{
-				&corev1.Pod{
-					TypeMeta: metav1.TypeMeta{
-						Kind:       "Pod",
-						APIVersion: "v1",
+			expectedPodInstance: &corev1.Pod{
+				TypeMeta: metav1.TypeMeta{
+					Kind:       "Pod",
+					APIVersion: "v1",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      providerID,
+					Namespace: "runner",
+					Labels: map[string]string{
+						spec.GarmInstanceNameLabel: instanceName,
+						spec.GarmFlavorLabel:       "ultra",
+						spec.GarmOSArchLabel:       "arm64",
+						spec.GarmOSTypeLabel:       "linux",
+						spec.GarmPoolIDLabel:       "ddce45e7-1bbb-4ecd-92cb-c733372b5cde",
+						spec.GarmControllerIDLabel: controllerID,
+						spec.GarmRunnerGroupLabel:  "",
 					},
-					ObjectMeta: metav1.ObjectMeta{
-						Name:      providerID,
-						Namespace: "runner",
-						Labels: map[string]string{
+				},
+				Spec: corev1.PodSpec{
+					Volumes: []corev1.Volume{
+						{
+							Name: "runner",
+							VolumeSource: corev1.VolumeSource{
+								EmptyDir: &corev1.EmptyDirVolumeSource{
+									Medium:    "",
+									SizeLimit: nil,
+								},
+							},
+						},
+					},
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers: []corev1.Container{
+						{
+							Name:  "runner",
+							Image: "localhost:5000/runner:ubuntu-22.04",
+							Env: []corev1.EnvVar{
+								{
+									Name:  "RUNNER_ORG",
+									Value: "testorg",
+								},
+								{
+									Name:  "RUNNER_REPO",
+									Value: "",
+								},
+								{
+									Name:  "RUNNER_ENTERPRISE",
+									Value: "",
+								},
+								{
+									Name:  "RUNNER_GROUP",
+									Value: "",
+								},
+								{
+									Name:  "RUNNER_NAME",
+									Value: instanceName,
+								},
+								{
+									Name:  "RUNNER_LABELS",
+									Value: "road-runner,linux,arm64,kubernetes",
+								},
+								{
+									Name:  "RUNNER_NO_DEFAULT_LABELS",
+									Value: "true",
+								},
+								{
+									Name:  "DISABLE_RUNNER_UPDATE",
+									Value: "true",
+								},
+								{
+									Name:  "RUNNER_WORKDIR",
+									Value: "/runner/_work/",
+								},
+								{
+									Name:  "GITHUB_URL",
+									Value: "https://github.com",
+								},
+								{
+									Name:  "RUNNER_EPHEMERAL",
+									Value: "true",
+								},
+								{
+									Name:  "RUNNER_TOKEN",
+									Value: "dummy",
+								},
+								{
+									Name:  "METADATA_URL",
+									Value: "https://metadata.test",
+								},
+								{
+									Name: "BEARER_TOKEN",
+									ValueFrom: &corev1.EnvVarSource{
+										SecretKeyRef: &corev1.SecretKeySelector{
+											LocalObjectReference: corev1.LocalObjectReference{
+												Name: providerID + "-credentials",
+											},
+											Key: "BEARER_TOKEN",
+										},
+									},
+								},
+								{
+									Name:  "CALLBACK_URL",
+									Value: "https://callback.test/status",
+								},
+								{
+									Name:  "JIT_CONFIG_ENABLED",
+									Value: "true",
+								},
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "runner",
+									ReadOnly:  false,
+									MountPath: "/runner",
+								},
+							},
+							ImagePullPolicy: "Always",
+							Resources: corev1.ResourceRequirements{
+								Limits: corev1.ResourceList{
+									corev1.ResourceMemory: resource.MustParse("1Gi"),
+								},
+								Requests: corev1.ResourceList{
+									corev1.ResourceCPU:    resource.MustParse("1"),
+									corev1.ResourceMemory: resource.MustParse("500Mi"),
+								},
+							},
+							LivenessProbe: &corev1.Probe{
+								ProbeHandler: corev1.ProbeHandler{
+									Exec: &corev1.ExecAction{
+										Command: []string{
+											"/bin/sh",
+											"-c",
+											"test -f /tmp/healthy",
+										},
+									},
+								},
+								InitialDelaySeconds:           5,
+								TimeoutSeconds:                5,
+								PeriodSeconds:                 1,
+								TerminationGracePeriodSeconds: nil,
+							},
+						},
+					},
+				},
+			},
+			runtimeObjects: []runtime.Object{},
+			err:            nil,
+		},
+		{
+			name: "Overwrite default runner emptyDir volume with a PVC",
+			config: &config.ProviderConfig{
+				KubeConfigPath:  "",
+				RunnerNamespace: "runner",
+				PodTemplate: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						Volumes: []corev1.Volume{
+							{
+								Name: "runner",
+								VolumeSource: corev1.VolumeSource{
+									Ephemeral: &corev1.EphemeralVolumeSource{
+										VolumeClaimTemplate: &corev1.PersistentVolumeClaimTemplate{
+											Spec: corev1.PersistentVolumeClaimSpec{
+												AccessModes: []corev1.PersistentVolumeAccessMode{
+													corev1.ReadWriteOnce,
+												},
+												StorageClassName: toPointer("cinder"),
+												Resources: corev1.VolumeResourceRequirements{
+													Requests: corev1.ResourceList{
+														corev1.ResourceStorage: resource.MustParse("1Gi"),
+													},
+												},
+											},
+										},
+									},
+								},
+							},
+						},
+						Containers: []corev1.Container{
+							{
+								Name: "runner",
+								Resources: corev1.ResourceRequirements{
+									Limits: corev1.ResourceList{
+										corev1.ResourceCPU:    resource.MustParse("500m"),
+										corev1.ResourceMemory: resource.MustParse("500Mi"),
+									},
+									Requests: corev1.ResourceList{
+										corev1.ResourceCPU:    resource.MustParse("500m"),
+										corev1.ResourceMemory: resource.MustParse("500Mi"),
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			bootstrapParams: params.BootstrapInstance{
+				Name:             instanceName,
+				PoolID:           poolID,
+				Flavor:           "small",
+				RepoURL:          "https://github.com/testorg",
+				InstanceToken:    "test-token",
+				MetadataURL:      "https://metadata.test",
+				CallbackURL:      "https://callback.test/status",
+				Image:            "localhost:5000/runner:ubuntu-22.04",
+				OSType:           "linux",
+				OSArch:           "arm64",
+				Labels:           []string{"road-runner", "linux", "arm64", "kubernetes"},
+				JitConfigEnabled: true,
+			},
+			expectedProviderInstance: params.ProviderInstance{
+				ProviderID: providerID,
+				Name:       instanceName,
+				OSType:     "linux",
+				OSName:     "",
+				OSVersion:  "",
+				OSArch:     "arm64",
+				Status:     "running",
+			},
+			expectedPodInstance: &corev1.Pod{
+				TypeMeta: metav1.TypeMeta{
+					Kind:       "Pod",
+					APIVersion: "v1",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      providerID,
+					Namespace: "runner",
+					Labels: map[string]string{
+						spec.GarmInstanceNameLabel: instanceName,
+						spec.GarmFlavorLabel:       "small",
+						spec.GarmOSArchLabel:       "arm64",
+						spec.GarmOSTypeLabel:       "linux",
+						spec.GarmPoolIDLabel:       "ddce45e7-1bbb-4ecd-92cb-c733372b5cde",
+						spec.GarmControllerIDLabel: controllerID,
+						spec.GarmRunnerGroupLabel:  "",
+					},
+				},
+				Spec: corev1.PodSpec{
+					Volumes: []corev1.Volume{
+						{
+							Name: "runner",
+							VolumeSource: corev1.VolumeSource{
+								Ephemeral: &corev1.EphemeralVolumeSource{
+									VolumeClaimTemplate: &corev1.PersistentVolumeClaimTemplate{
+										Spec: corev1.PersistentVolumeClaimSpec{
+											AccessModes: []corev1.PersistentVolumeAccessMode{
+												corev1.ReadWriteOnce,
+											},
+											StorageClassName: toPointer("cinder"),
+											Resources: corev1.VolumeResourceRequirements{
+												Requests: corev1.ResourceList{
+													corev1.ResourceStorage: resource.MustParse("1Gi"),
+												},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers: []corev1.Container{
+						{
+							Name:  "runner",
+							Image: "localhost:5000/runner:ubuntu-22.04",
+							Env: []corev1.EnvVar{
+								{
+									Name:  "RUNNER_ORG",
+									Value: "testorg",
+								},
+								{
+									Name:  "RUNNER_REPO",
+									Value: "",
+								},
+								{
+									Name:  "RUNNER_ENTERPRISE",
+									Value: "",
+								},
+								{
+									Name:  "RUNNER_GROUP",
+									Value: "",
+								},
+								{
+									Name:  "RUNNER_NAME",
+									Value: instanceName,
+								},
+								{
+									Name:  "RUNNER_LABELS",
+									Value: "road-runner,linux,arm64,kubernetes",
+								},
+								{
+									Name:  "RUNNER_NO_DEFAULT_LABELS",
+									Value: "true",
+								},
+								{
+									Name:  "DISABLE_RUNNER_UPDATE",
+									Value: "true",
+								},
+								{
+									Name:  "RUNNER_WORKDIR",
+									Value: "/runner/_work/",
+								},
+								{
+									Name:  "GITHUB_URL",
+									Value: "https://github.com",
+								},
+								{
+									Name:  "RUNNER_EPHEMERAL",
+									Value: "true",
+								},
+								{
+									Name:  "RUNNER_TOKEN",
+									Value: "dummy",
+								},
+								{
+									Name:  "METADATA_URL",
+									Value: "https://metadata.test",
+								},
+								{
+									Name: "BEARER_TOKEN",
+									ValueFrom: &corev1.EnvVarSource{
+										SecretKeyRef: &corev1.SecretKeySelector{
+											LocalObjectReference: corev1.LocalObjectReference{
+												Name: providerID + "-credentials",
+											},
+											Key: "BEARER_TOKEN",
+										},
+									},
+								},
+								{
+									Name:  "CALLBACK_URL",
+									Value: "https://callback.test/status",
+								},
+								{
+									Name:  "JIT_CONFIG_ENABLED",
+									Value: "true",
+								},
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "runner",
+									ReadOnly:  false,
+									MountPath: "/runner",
+								},
+							},
+							ImagePullPolicy: "Always",
+							Resources: corev1.ResourceRequirements{
+								Limits: corev1.ResourceList{
+									corev1.ResourceCPU:    resource.MustParse("500m"),
+									corev1.ResourceMemory: resource.MustParse("500Mi"),
+								},
+								Requests: corev1.ResourceList{
+									corev1.ResourceCPU:    resource.MustParse("500m"),
+									corev1.ResourceMemory: resource.MustParse("500Mi"),
+								},
+							},
+						},
+					},
+				},
+			},
+			runtimeObjects: []runtime.Object{},
+			err:            nil,
+		},
+		{
+			name: "Use new runner volume and corresponding volumemount with custom name",
+			config: &config.ProviderConfig{
+				KubeConfigPath:  "",
+				RunnerNamespace: "runner",
+				PodTemplate: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						Volumes: []corev1.Volume{
+							{
+								Name: "runner-vol",
+								VolumeSource: corev1.VolumeSource{
+									Ephemeral: &corev1.EphemeralVolumeSource{
+										VolumeClaimTemplate: &corev1.PersistentVolumeClaimTemplate{
+											Spec: corev1.PersistentVolumeClaimSpec{
+												AccessModes: []corev1.PersistentVolumeAccessMode{
+													corev1.ReadWriteOnce,
+												},
+												StorageClassName: toPointer("cinder"),
+												Resources: corev1.VolumeResourceRequirements{
+													Requests: corev1.ResourceList{
+														corev1.ResourceStorage: resource.MustParse("1Gi"),
+													},
+												},
+											},
+										},
+									},
+								},
+							},
+						},
+						Containers: []corev1.Container{
+							{
+								Name: "runner",
+								Resources: corev1.ResourceRequirements{
+									Limits: corev1.ResourceList{
+										corev1.ResourceCPU:    resource.MustParse("500m"),
+										corev1.ResourceMemory: resource.MustParse("500Mi"),
+									},
+									Requests: corev1.ResourceList{
+										corev1.ResourceCPU:    resource.MustParse("500m"),
+										corev1.ResourceMemory: resource.MustParse("500Mi"),
+									},
+								},
+								VolumeMounts: []corev1.VolumeMount{
+									{
+										Name:      "runner-vol",
+										ReadOnly:  false,
+										MountPath: "/runner",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			bootstrapParams: params.BootstrapInstance{
+				Name:             instanceName,
+				PoolID:           poolID,
+				Flavor:           "small",
+				RepoURL:          "https://github.com/testorg",
+				InstanceToken:    "test-token",
+				MetadataURL:      "https://metadata.test",
+				CallbackURL:      "https://callback.test/status",
+				Image:            "localhost:5000/runner:ubuntu-22.04",
+				OSType:           "linux",
+				OSArch:           "arm64",
+				Labels:           []string{"road-runner", "linux", "arm64", "kubernetes"},
+				JitConfigEnabled: true,
+			},
+			expectedProviderInstance: params.ProviderInstance{
+				ProviderID: providerID,
+				Name:       instanceName,
+				OSType:     "linux",
+				OSName:     "",
+				OSVersion:  "",
+				OSArch:     "arm64",
+				Status:     "running",
+			},
+			expectedPodInstance: &corev1.Pod{
+				TypeMeta: metav1.TypeMeta{
+					Kind:       "Pod",
+					APIVersion: "v1",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      providerID,
+					Namespace: "runner",
+					Labels: map[string]string{
+						spec.GarmInstanceNameLabel: instanceName,
+						spec.GarmFlavorLabel:       "small",
+						spec.GarmOSArchLabel:       "arm64",
+						spec.GarmOSTypeLabel:       "linux",
+						spec.GarmPoolIDLabel:       "ddce45e7-1bbb-4ecd-92cb-c733372b5cde",
+						spec.GarmControllerIDLabel: controllerID,
+						spec.GarmRunnerGroupLabel:  "",
+					},
+				},
+				Spec: corev1.PodSpec{
+					Volumes: []corev1.Volume{
+						{
+							Name: "runner-vol",
+							VolumeSource: corev1.VolumeSource{
+								Ephemeral: &corev1.EphemeralVolumeSource{
+									VolumeClaimTemplate: &corev1.PersistentVolumeClaimTemplate{
+										Spec: corev1.PersistentVolumeClaimSpec{
+											AccessModes: []corev1.PersistentVolumeAccessMode{
+												corev1.ReadWriteOnce,
+											},
+											StorageClassName: toPointer("cinder"),
+											Resources: corev1.VolumeResourceRequirements{
+												Requests: corev1.ResourceList{
+													corev1.ResourceStorage: resource.MustParse("1Gi"),
+												},
+											},
+										},
+									},
+								},
+							},
+						},
+						{
+							Name: "runner",
+							VolumeSource: corev1.VolumeSource{
+								EmptyDir: &corev1.EmptyDirVolumeSource{
+									Medium:    "",
+									SizeLimit: nil,
+								},
+							},
+						},
+					},
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers: []corev1.Container{
+						{
+							Name:  "runner",
+							Image: "localhost:5000/runner:ubuntu-22.04",
+							Env: []corev1.EnvVar{
+								{
+									Name:  "RUNNER_ORG",
+									Value: "testorg",
+								},
+								{
+									Name:  "RUNNER_REPO",
+									Value: "",
+								},
+								{
+									Name:  "RUNNER_ENTERPRISE",
+									Value: "",
+								},
+								{
+									Name:  "RUNNER_GROUP",
+									Value: "",
+								},
+								{
+									Name:  "RUNNER_NAME",
+									Value: instanceName,
+								},
+								{
+									Name:  "RUNNER_LABELS",
+									Value: "road-runner,linux,arm64,kubernetes",
+								},
+								{
+									Name:  "RUNNER_NO_DEFAULT_LABELS",
+									Value: "true",
+								},
+								{
+									Name:  "DISABLE_RUNNER_UPDATE",
+									Value: "true",
+								},
+								{
+									Name:  "RUNNER_WORKDIR",
+									Value: "/runner/_work/",
+								},
+								{
+									Name:  "GITHUB_URL",
+									Value: "https://github.com",
+								},
+								{
+									Name:  "RUNNER_EPHEMERAL",
+									Value: "true",
+								},
+								{
+									Name:  "RUNNER_TOKEN",
+									Value: "dummy",
+								},
+								{
+									Name:  "METADATA_URL",
+									Value: "https://metadata.test",
+								},
+								{
+									Name: "BEARER_TOKEN",
+									ValueFrom: &corev1.EnvVarSource{
+										SecretKeyRef: &corev1.SecretKeySelector{
+											LocalObjectReference: corev1.LocalObjectReference{
+												Name: providerID + "-credentials",
+											},
+											Key: "BEARER_TOKEN",
+										},
+									},
+								},
+								{
+									Name:  "CALLBACK_URL",
+									Value: "https://callback.test/status",
+								},
+								{
+									Name:  "JIT_CONFIG_ENABLED",
+									Value: "true",
+								},
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "runner-vol",
+									ReadOnly:  false,
+									MountPath: "/runner",
+								},
+							},
+							ImagePullPolicy: "Always",
+							Resources: corev1.ResourceRequirements{
+								Limits: corev1.ResourceList{
+									corev1.ResourceCPU:    resource.MustParse("500m"),
+									corev1.ResourceMemory: resource.MustParse("500Mi"),
+								},
+								Requests: corev1.ResourceList{
+									corev1.ResourceCPU:    resource.MustParse("500m"),
+									corev1.ResourceMemory: resource.MustParse("500Mi"),
+								},
+							},
+						},
+					},
+				},
+			},
+			runtimeObjects: []runtime.Object{},
+			err:            nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// create the provider config
+			cfg := tc.config
+
+			// create a fake kubernetes client
+			client := fake.NewSimpleClientset(tc.runtimeObjects...)
+
+			// initialize the provider
+			p, _ := provider.NewKubernetesProvider(cfg, client, controllerID, poolID)
+
+			// the final pod spec gets persisted as annotation to be able to start a stopped instance
+			podSpec, err := json.Marshal(tc.expectedPodInstance.Spec)
+			assert.NoError(t, err)
+			metav1.SetMetaDataAnnotation(&tc.expectedPodInstance.ObjectMeta, spec.GarmPodSpecAnnotation, string(podSpec))
+
+			// the original values of the garm labels are kept as annotations
+			for annotation, value := range spec.ParamsToPodAnnotations(tc.bootstrapParams) {
+				metav1.SetMetaDataAnnotation(&tc.expectedPodInstance.ObjectMeta, annotation, value)
+			}
+
+			// trigger the instance creation
+			actual, err := p.CreateInstance(context.Background(), tc.bootstrapParams)
+			assert.Equal(t, tc.err, err)
+
+			// get the created pod
+			createdPod, err := client.CoreV1().Pods(cfg.RunnerNamespace).Get(context.Background(), actual.ProviderID, metav1.GetOptions{})
+			assert.Equal(t, tc.err, err)
+
+			// compare created instance with expected instance
+			assert.Equal(t, tc.expectedProviderInstance, actual)
+
+			// compare created pod with expected pod
+			assert.Equal(t, tc.expectedPodInstance, createdPod)
+
+			// the instance token is stored in a secret owned by the pod
+			runnerSecret, err := client.CoreV1().Secrets(cfg.RunnerNamespace).Get(context.Background(), actual.ProviderID+"-credentials", metav1.GetOptions{})
+			assert.Equal(t, tc.err, err)
+			assert.Equal(t, []byte(tc.bootstrapParams.InstanceToken), runnerSecret.Data["BEARER_TOKEN"])
+			assert.Equal(t, "Pod", runnerSecret.OwnerReferences[0].Kind)
+			assert.Equal(t, createdPod.Name, runnerSecret.OwnerReferences[0].Name)
+			assert.Equal(t, createdPod.Name, runnerSecret.Labels[spec.GarmPodNameLabel])
+		})
+	}
+}
+
+func TestCreateInstanceCleansUpAuxiliaryObjects(t *testing.T) {
+	cfg := &config.ProviderConfig{
+		RunnerNamespace: "runner",
+	}
+
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("create", "pods", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(corev1.Resource("pods"), providerID, errors.New("exceeded quota"))
+	})
+
+	p, _ := provider.NewKubernetesProvider(cfg, client, controllerID, poolID)
+
+	_, err := p.CreateInstance(context.Background(), params.BootstrapInstance{
+		Name:          instanceName,
+		PoolID:        poolID,
+		Flavor:        "small",
+		RepoURL:       "https://github.com/testorg",
+		InstanceToken: "test-token",
+		Image:         "localhost:5000/runner:ubuntu-22.04",
+		OSType:        "linux",
+		OSArch:        "arm64",
+	})
+	assert.ErrorContains(t, err, "exceeded quota")
+
+	// the secret of the pod which could not be created must not be leaked
+	secrets, err := client.CoreV1().Secrets("runner").List(context.Background(), metav1.ListOptions{})
+	assert.NoError(t, err)
+	assert.Empty(t, secrets.Items)
+}
+
+func TestCreateInstanceIsIdempotent(t *testing.T) {
+	bootstrapParams := params.BootstrapInstance{
+		Name:          instanceName,
+		PoolID:        poolID,
+		Flavor:        "small",
+		RepoURL:       "https://github.com/testorg",
+		InstanceToken: "test-token",
+		Image:         "localhost:5000/runner:ubuntu-22.04",
+		OSType:        "linux",
+		OSArch:        "arm64",
+	}
+	conflictingPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      providerID,
+			Namespace: "runner",
+			Labels: map[string]string{
+				spec.GarmInstanceNameLabel: instanceName,
+				spec.GarmPoolIDLabel:       poolID,
+				spec.GarmControllerIDLabel: "other-controller",
+			},
+		},
+	}
+	conflictingSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      spec.RunnerSecretName(providerID),
+			Namespace: "runner",
+		},
+		StringData: map[string]string{
+			"BEARER_TOKEN": "other-token",
+		},
+	}
+
+	testCases := []struct {
+		name           string
+		runtimeObjects []runtime.Object
+		concurrent     bool
+		wantErr        string
+	}{
+		{
+			name: "Retried create returns the existing instance",
+		},
+		{
+			name:       "Concurrent create returns the existing instance",
+			concurrent: true,
+		},
+		{
+			name:           "Pod of another controller is a conflict",
+			runtimeObjects: []runtime.Object{conflictingPod, conflictingSecret},
+			wantErr:        `pod garm-hvjedclmnvry already exists in namespace runner, but belongs to instance "garm-HvjEdcLmnVrY" of pool "ddce45e7-1bbb-4ecd-92cb-c733372b5cde" of controller "other-controller"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &config.ProviderConfig{
+				RunnerNamespace: "runner",
+			}
+
+			client := fake.NewSimpleClientset(tc.runtimeObjects...)
+			p, _ := provider.NewKubernetesProvider(cfg, client, controllerID, poolID)
+
+			var firstInstance params.ProviderInstance
+			if tc.wantErr == "" {
+				var err error
+				firstInstance, err = p.CreateInstance(context.Background(), bootstrapParams)
+				assert.NoError(t, err)
+			}
+
+			if tc.concurrent {
+				// the pod is not found before the create, as another attempt creates it concurrently
+				gets := 0
+				client.PrependReactor("get", "pods", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+					gets++
+					if gets == 1 {
+						return true, nil, apierrors.NewNotFound(corev1.Resource("pods"), providerID)
+					}
+					return false, nil, nil
+				})
+			}
+
+			instance, err := p.CreateInstance(context.Background(), bootstrapParams)
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, "error calling CreateInstance: "+tc.wantErr)
+
+				secret, err := client.CoreV1().Secrets("runner").Get(context.Background(), spec.RunnerSecretName(providerID), metav1.GetOptions{})
+				assert.NoError(t, err)
+				assert.Equal(t, conflictingSecret, secret)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, firstInstance, instance)
+
+			pods, err := client.CoreV1().Pods("runner").List(context.Background(), metav1.ListOptions{})
+			assert.NoError(t, err)
+			assert.Len(t, pods.Items, 1)
+		})
+	}
+}
+
+func TestInstanceNameToPodName(t *testing.T) {
+	testCases := []struct {
+		name            string
+		instanceName    string
+		expectedPodName string
+	}{
+		{
+			name:            "Valid instance name is lowercased",
+			instanceName:    instanceName,
+			expectedPodName: providerID,
+		},
+		{
+			name:            "Invalid characters are replaced",
+			instanceName:    "garm_Pool.Name-abc",
+			expectedPodName: "garm-pool-name-abc-61eeaadd",
+		},
+		{
+			name:            "Long instance name is truncated",
+			instanceName:    "garm-" + strings.Repeat("a", 70),
+			expectedPodName: "garm-" + strings.Repeat("a", 49) + "-73e368b7",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &config.ProviderConfig{
+				RunnerNamespace: "runner",
+			}
+
+			client := fake.NewSimpleClientset()
+			p, _ := provider.NewKubernetesProvider(cfg, client, controllerID, poolID)
+
+			instance, err := p.CreateInstance(context.Background(), params.BootstrapInstance{
+				Name:          tc.instanceName,
+				PoolID:        poolID,
+				Flavor:        "small",
+				RepoURL:       "https://github.com/testorg",
+				InstanceToken: "test-token",
+				Image:         "localhost:5000/runner:ubuntu-22.04",
+				OSType:        "linux",
+				OSArch:        "arm64",
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedPodName, instance.ProviderID)
+			assert.LessOrEqual(t, len(instance.ProviderID), 63)
+
+			// garm uses the instance name if the instance got no ProviderID
+			for _, id := range []string{tc.instanceName, instance.ProviderID} {
+				instance, err := p.GetInstance(context.Background(), id)
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedPodName, instance.ProviderID)
+			}
+
+			err = p.DeleteInstance(context.Background(), tc.instanceName)
+			assert.NoError(t, err)
+
+			pods, err := client.CoreV1().Pods("runner").List(context.Background(), metav1.ListOptions{})
+			assert.NoError(t, err)
+			assert.Empty(t, pods.Items)
+		})
+	}
+}
+
+func TestLabelsKeepOriginalValuesInAnnotations(t *testing.T) {
+	cfg := &config.ProviderConfig{
+		RunnerNamespace: "runner",
+	}
+
+	client := fake.NewSimpleClientset()
+	p, _ := provider.NewKubernetesProvider(cfg, client, controllerID, poolID)
+
+	longInstanceName := "garm-" + strings.Repeat("A", 70)
+	instance, err := p.CreateInstance(context.Background(), params.BootstrapInstance{
+		Name:              longInstanceName,
+		PoolID:            poolID,
+		Flavor:            "large/gpu",
+		RepoURL:           "https://github.com/testorg",
+		InstanceToken:     "test-token",
+		Image:             "localhost:5000/runner:ubuntu-22.04",
+		OSType:            "linux",
+		OSArch:            "arm64",
+		GitHubRunnerGroup: "my runner group",
+		ExtraSpecs:        json.RawMessage(`{"OSName": "Ubuntu Linux", "OSVersion": "22.04 LTS (jammy)"}`),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, longInstanceName, instance.Name)
+	assert.Equal(t, "Ubuntu Linux", instance.OSName)
+	assert.Equal(t, "22.04 LTS (jammy)", instance.OSVersion)
+
+	pod, err := client.CoreV1().Pods("runner").Get(context.Background(), instance.ProviderID, metav1.GetOptions{})
+	assert.NoError(t, err)
+	for label, value := range pod.Labels {
+		assert.Empty(t, validation.IsValidLabelValue(value), "label %s", label)
+	}
+	assert.Equal(t, "garm-"+strings.Repeat("A", 49)+"-9fd18467", pod.Labels[spec.GarmInstanceNameLabel])
+	assert.Equal(t, "large_gpu", pod.Labels[spec.GarmFlavorLabel])
+	assert.Equal(t, "my_runner_group", pod.Labels[spec.GarmRunnerGroupLabel])
+	assert.Equal(t, "Ubuntu_Linux", pod.Labels[spec.GarmOSNameLabel])
+	assert.Equal(t, "22.04_LTS__jammy0", pod.Labels[spec.GarmOSVersionLabel])
+
+	assert.Equal(t, longInstanceName, pod.Annotations[spec.GarmInstanceNameAnnotation])
+	assert.Equal(t, "large/gpu", pod.Annotations[spec.GarmFlavorAnnotation])
+	assert.Equal(t, "my runner group", pod.Annotations[spec.GarmRunnerGroupAnnotation])
+	assert.Equal(t, "Ubuntu Linux", pod.Annotations[spec.GarmOSNameAnnotation])
+	assert.Equal(t, "22.04 LTS (jammy)", pod.Annotations[spec.GarmOSVersionAnnotation])
+
+	// the instance is found by its original name and reported with the original values
+	instance, err = p.GetInstance(context.Background(), longInstanceName)
+	assert.NoError(t, err)
+	assert.Equal(t, pod.Name, instance.ProviderID)
+	assert.Equal(t, longInstanceName, instance.Name)
+	assert.Equal(t, "Ubuntu Linux", instance.OSName)
+	assert.Equal(t, "22.04 LTS (jammy)", instance.OSVersion)
+}
+
+func TestCreateInstanceWithFlavor(t *testing.T) {
+	cfg := &config.ProviderConfig{
+		RunnerNamespace: "runner",
+		PodTemplate: corev1.PodTemplateSpec{
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{},
+				NodeSelector: map[string]string{
+					"kubernetes.io/os": "linux",
+				},
+			},
+		},
+		Flavors: map[string]config.Flavor{
+			"arm64-large": {
+				ResourceRequirements: corev1.ResourceRequirements{
+					Limits: corev1.ResourceList{
+						"nvidia.com/gpu": resource.MustParse("1"),
+					},
+					Requests: corev1.ResourceList{
+						corev1.ResourceCPU:              resource.MustParse("2"),
+						corev1.ResourceEphemeralStorage: resource.MustParse("10Gi"),
+					},
+				},
+				NodeSelector: map[string]string{
+					"kubernetes.io/arch": "arm64",
+				},
+				Tolerations: []corev1.Toleration{
+					{
+						Key:      "dedicated",
+						Operator: corev1.TolerationOpEqual,
+						Value:    "runner",
+						Effect:   corev1.TaintEffectNoSchedule,
+					},
+				},
+				PriorityClassName: "runner",
+				RuntimeClassName:  ptr.To("gvisor"),
+				PodTemplate: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{
+						Labels: map[string]string{"node-pool": "arm64-large"},
+					},
+				},
+			},
+		},
+	}
+
+	client := fake.NewSimpleClientset()
+
+	p, _ := provider.NewKubernetesProvider(cfg, client, controllerID, poolID)
+
+	actual, err := p.CreateInstance(context.Background(), params.BootstrapInstance{
+		Name:          instanceName,
+		PoolID:        poolID,
+		Flavor:        "arm64-large",
+		RepoURL:       "https://github.com/testorg",
+		InstanceToken: "test-token",
+		Image:         "localhost:5000/runner:ubuntu-22.04",
+		OSType:        "linux",
+		OSArch:        "arm64",
+	})
+	assert.NoError(t, err)
+
+	createdPod, err := client.CoreV1().Pods("runner").Get(context.Background(), actual.ProviderID, metav1.GetOptions{})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "arm64-large", createdPod.Labels["node-pool"])
+	assert.Equal(t, map[string]string{
+		"kubernetes.io/arch": "arm64",
+		"kubernetes.io/os":   "linux",
+	}, createdPod.Spec.NodeSelector)
+	assert.Equal(t, cfg.Flavors["arm64-large"].Tolerations, createdPod.Spec.Tolerations)
+	assert.Equal(t, "runner", createdPod.Spec.PriorityClassName)
+	assert.Equal(t, ptr.To("gvisor"), createdPod.Spec.RuntimeClassName)
+
+	resources := createdPod.Spec.Containers[0].Resources
+	assert.True(t, resources.Limits.Name("nvidia.com/gpu", resource.DecimalSI).Equal(resource.MustParse("1")))
+	assert.True(t, resources.Requests.Cpu().Equal(resource.MustParse("2")))
+	assert.True(t, resources.Requests.StorageEphemeral().Equal(resource.MustParse("10Gi")))
+}
+
+func TestCreateInstanceResourcePrecedence(t *testing.T) {
+	runnerResources := func(cpu string) corev1.PodTemplateSpec {
+		return corev1.PodTemplateSpec{
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{
+					{
+						Name: "runner",
+						Resources: corev1.ResourceRequirements{
+							Requests: corev1.ResourceList{
+								corev1.ResourceCPU: resource.MustParse(cpu),
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	testCases := []struct {
+		name        string
+		globalCPU   string
+		extraSpecs  string
+		expectedCPU string
+	}{
+		{
+			name:        "flavor",
+			expectedCPU: "200m",
+		},
+		{
+			name:        "global pod template overrides flavor",
+			globalCPU:   "100m",
+			expectedCPU: "100m",
+		},
+		{
+			name:        "named pod template overrides global pod template",
+			globalCPU:   "100m",
+			extraSpecs:  `{"podTemplateName":"large"}`,
+			expectedCPU: "300m",
+		},
+		{
+			name:        "extra specs override named pod template",
+			globalCPU:   "100m",
+			extraSpecs:  `{"podTemplateName":"large","podTemplate":{"spec":{"containers":[{"name":"runner","resources":{"requests":{"cpu":"400m"}}}]}}}`,
+			expectedCPU: "400m",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &config.ProviderConfig{
+				RunnerNamespace: "runner",
+				PodTemplates: map[string]corev1.PodTemplateSpec{
+					"large": runnerResources("300m"),
+				},
+				Flavors: map[string]config.Flavor{
+					"small": {
+						ResourceRequirements: corev1.ResourceRequirements{
+							Requests: corev1.ResourceList{
+								corev1.ResourceCPU: resource.MustParse("200m"),
+							},
+						},
+					},
+				},
+			}
+			if tc.globalCPU != "" {
+				cfg.PodTemplate = runnerResources(tc.globalCPU)
+			}
+
+			client := fake.NewSimpleClientset()
+
+			p, _ := provider.NewKubernetesProvider(cfg, client, controllerID, poolID)
+
+			bootstrapParams := params.BootstrapInstance{
+				Name:          instanceName,
+				PoolID:        poolID,
+				Flavor:        "small",
+				RepoURL:       "https://github.com/testorg",
+				InstanceToken: "test-token",
+				Image:         "localhost:5000/runner:ubuntu-22.04",
+				OSType:        "linux",
+				OSArch:        "amd64",
+			}
+			if tc.extraSpecs != "" {
+				bootstrapParams.ExtraSpecs = json.RawMessage(tc.extraSpecs)
+			}
+
+			actual, err := p.CreateInstance(context.Background(), bootstrapParams)
+			assert.NoError(t, err)
+
+			createdPod, err := client.CoreV1().Pods("runner").Get(context.Background(), actual.ProviderID, metav1.GetOptions{})
+			assert.NoError(t, err)
+
+			var runnerContainer *corev1.Container
+			for i := range createdPod.Spec.Containers {
+				if createdPod.Spec.Containers[i].Name == "runner" {
+					runnerContainer = &createdPod.Spec.Containers[i]
+				}
+			}
+			if assert.NotNil(t, runnerContainer) {
+				assert.True(t, runnerContainer.Resources.Requests.Cpu().Equal(resource.MustParse(tc.expectedCPU)), "got cpu request %s", runnerContainer.Resources.Requests.Cpu())
+			}
+		})
+	}
+}
+
+func TestCreateInstanceWithUnknownFlavor(t *testing.T) {
+	testCases := []struct {
+		name              string
+		policy            string
+		flavor            string
+		expectedResources corev1.ResourceRequirements
+		expectedLabel     string
+		wantErr           string
+	}{
+		{
+			name:              "best effort",
+			policy:            config.UnknownFlavorPolicyBestEffort,
+			flavor:            "smal",
+			expectedResources: corev1.ResourceRequirements{},
+		},
+		{
+			name:   "default flavor",
+			policy: config.UnknownFlavorPolicyDefaultFlavor,
+			flavor: "smal",
+			expectedResources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceCPU: resource.MustParse("500m"),
+				},
+			},
+		},
+		{
+			name:    "reject",
+			policy:  config.UnknownFlavorPolicyReject,
+			flavor:  "smal",
+			wantErr: `error calling CreateInstance: invalid flavor of pool ` + poolID + `: flavor "smal" is not configured`,
+		},
+		{
+			name:              "reject keeps flavors of named pod templates",
+			policy:            config.UnknownFlavorPolicyReject,
+			flavor:            "dind",
+			expectedResources: corev1.ResourceRequirements{},
+			expectedLabel:     "dind",
+		},
+		{
+			name:              "reject keeps flavors routed to a cluster",
+			policy:            config.UnknownFlavorPolicyReject,
+			flavor:            "arm64-large",
+			expectedResources: corev1.ResourceRequirements{},
+		},
+		{
+			name:              "default flavor keeps flavors of named pod templates",
+			policy:            config.UnknownFlavorPolicyDefaultFlavor,
+			flavor:            "dind",
+			expectedResources: corev1.ResourceRequirements{},
+			expectedLabel:     "dind",
+		},
+		{
+			name:              "default flavor keeps flavors routed to a cluster",
+			policy:            config.UnknownFlavorPolicyDefaultFlavor,
+			flavor:            "arm64-large",
+			expectedResources: corev1.ResourceRequirements{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &config.ProviderConfig{
+				RunnerNamespace:     "runner",
+				UnknownFlavorPolicy: tc.policy,
+				DefaultFlavor:       "small",
+				Flavors: map[string]config.Flavor{
+					"small": {ResourceRequirements: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{
+							corev1.ResourceCPU: resource.MustParse("500m"),
+						},
+					}},
+				},
+				PodTemplates: map[string]corev1.PodTemplateSpec{
+					"dind": {
+						ObjectMeta: metav1.ObjectMeta{
+							Labels: map[string]string{"pod-template": "dind"},
+						},
+					},
+				},
+				Clusters: map[string]config.ClusterConfig{
+					"arm": {Flavors: []string{"arm64-large"}},
+				},
+			}
+
+			client := fake.NewSimpleClientset()
+
+			p, _ := provider.NewKubernetesProvider(cfg, client, controllerID, poolID)
+
+			actual, err := p.CreateInstance(context.Background(), params.BootstrapInstance{
+				Name:          instanceName,
+				PoolID:        poolID,
+				Flavor:        tc.flavor,
+				RepoURL:       "https://github.com/testorg",
+				InstanceToken: "test-token",
+				Image:         "localhost:5000/runner:ubuntu-22.04",
+				OSType:        "linux",
+				OSArch:        "arm64",
+			})
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+
+				pods, err := client.CoreV1().Pods("runner").List(context.Background(), metav1.ListOptions{})
+				assert.NoError(t, err)
+				assert.Empty(t, pods.Items)
+				return
+			}
+			assert.NoError(t, err)
+
+			createdPod, err := client.CoreV1().Pods("runner").Get(context.Background(), actual.ProviderID, metav1.GetOptions{})
+			assert.NoError(t, err)
+			assert.True(t, equality.Semantic.DeepEqual(tc.expectedResources, createdPod.Spec.Containers[0].Resources), "unexpected resources %v", createdPod.Spec.Containers[0].Resources)
+			assert.Equal(t, tc.expectedLabel, createdPod.Labels["pod-template"])
+		})
+	}
+}
+
+func TestCreateInstanceWithCABundle(t *testing.T) {
+	caCertBundle := []byte("-----BEGIN CERTIFICATE-----\ninternal-ca\n-----END CERTIFICATE-----\n")
+
+	cfg := &config.ProviderConfig{
+		RunnerNamespace: "runner",
+	}
+
+	client := fake.NewSimpleClientset()
+
+	p, _ := provider.NewKubernetesProvider(cfg, client, controllerID, poolID)
+
+	actual, err := p.CreateInstance(context.Background(), params.BootstrapInstance{
+		Name:          instanceName,
+		PoolID:        poolID,
+		Flavor:        "small",
+		RepoURL:       "https://github.com/testorg",
+		InstanceToken: "test-token",
+		Image:         "localhost:5000/runner:ubuntu-22.04",
+		OSType:        "linux",
+		OSArch:        "arm64",
+		CACertBundle:  caCertBundle,
+	})
+	assert.NoError(t, err)
+
+	createdPod, err := client.CoreV1().Pods("runner").Get(context.Background(), actual.ProviderID, metav1.GetOptions{})
+	assert.NoError(t, err)
+
+	assert.Contains(t, createdPod.Spec.Volumes, corev1.Volume{
+		Name: "garm-ca-bundle",
+		VolumeSource: corev1.VolumeSource{
+			Projected: &corev1.ProjectedVolumeSource{
+				Sources: []corev1.VolumeProjection{
+					{
+						ConfigMap: &corev1.ConfigMapProjection{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: providerID + "-ca-bundle",
+							},
+							Items: []corev1.KeyToPath{
+								{
+									Key:  "ca-bundle.crt",
+									Path: "ca-bundle.crt",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	})
+	assert.Contains(t, createdPod.Spec.Containers[0].VolumeMounts, corev1.VolumeMount{
+		Name:      "garm-ca-bundle",
+		MountPath: "/etc/garm/ca",
+		ReadOnly:  true,
+	})
+	assert.Contains(t, createdPod.Spec.Containers[0].Env, corev1.EnvVar{Name: "GARM_CA_BUNDLE_FILE", Value: "/etc/garm/ca/ca-bundle.crt"})
+	// the entrypoint combines the bundle with the system CAs, it must not replace them
+	for _, env := range createdPod.Spec.Containers[0].Env {
+		assert.NotEqual(t, "SSL_CERT_FILE", env.Name)
+	}
+	assert.Contains(t, createdPod.Spec.Containers[0].Env, corev1.EnvVar{Name: "NODE_EXTRA_CA_CERTS", Value: "/etc/garm/ca/ca-bundle.crt"})
+
+	caBundleConfigMap, err := client.CoreV1().ConfigMaps("runner").Get(context.Background(), providerID+"-ca-bundle", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, string(caCertBundle), caBundleConfigMap.Data["ca-bundle.crt"])
+	assert.Equal(t, "Pod", caBundleConfigMap.OwnerReferences[0].Kind)
+	assert.Equal(t, createdPod.Name, caBundleConfigMap.OwnerReferences[0].Name)
+}
+
+func TestCreateInstanceWithRunnerTools(t *testing.T) {
+	tools := []params.RunnerApplicationDownload{
+		{
+			OS:                ptr.To("linux"),
+			Architecture:      ptr.To("x64"),
+			DownloadURL:       ptr.To("https://github.com/actions/runner/releases/download/v2.320.0/actions-runner-linux-x64-2.320.0.tar.gz"),
+			Filename:          ptr.To("actions-runner-linux-x64-2.320.0.tar.gz"),
+			SHA256Checksum:    ptr.To("93ac1b7ce743ee85b5d386f5c1787385ef07b3d7c728ff66ce0d3813d5f46900"),
+			TempDownloadToken: ptr.To("download-token"),
+		},
+		{
+			OS:           ptr.To("linux"),
+			Architecture: ptr.To("arm64"),
+			DownloadURL:  ptr.To("https://github.com/actions/runner/releases/download/v2.320.0/actions-runner-linux-arm64-2.320.0.tar.gz"),
+			Filename:     ptr.To("actions-runner-linux-arm64-2.320.0.tar.gz"),
+		},
+	}
+
+	testCases := []struct {
+		name               string
+		installMode        string
+		extraSpecs         string
+		osArch             params.OSArch
+		expectedInstaller  bool
+		expectedToolsURL   string
+		expectedToolsToken string
+		wantErr            string
+	}{
+		{
+			name:               "Runner is installed from the tools matching amd64",
+			installMode:        config.RunnerInstallModeTools,
+			osArch:             params.Amd64,
+			expectedInstaller:  true,
+			expectedToolsURL:   "https://github.com/actions/runner/releases/download/v2.320.0/actions-runner-linux-x64-2.320.0.tar.gz",
+			expectedToolsToken: "download-token",
+		},
+		{
+			name:              "Runner is installed from the tools matching arm64",
+			installMode:       config.RunnerInstallModeTools,
+			osArch:            params.Arm64,
+			expectedInstaller: true,
+			expectedToolsURL:  "https://github.com/actions/runner/releases/download/v2.320.0/actions-runner-linux-arm64-2.320.0.tar.gz",
+		},
+		{
+			name:               "Pool enables tools mode via extra_specs",
+			installMode:        config.RunnerInstallModeImage,
+			extraSpecs:         `{"runnerInstallMode": "tools"}`,
+			osArch:             params.Amd64,
+			expectedInstaller:  true,
+			expectedToolsURL:   "https://github.com/actions/runner/releases/download/v2.320.0/actions-runner-linux-x64-2.320.0.tar.gz",
+			expectedToolsToken: "download-token",
+		},
+		{
+			name:        "Pool disables tools mode via extra_specs",
+			installMode: config.RunnerInstallModeTools,
+			extraSpecs:  `{"runnerInstallMode": "image"}`,
+			osArch:      params.Amd64,
+		},
+		{
+			name:        "No tools for the architecture of the pool",
+			installMode: config.RunnerInstallModeTools,
+			osArch:      params.Arm,
+			wantErr:     "failed to find tools for OS linux and arch arm",
+		},
+		{
+			name:        "Invalid install mode in extra_specs",
+			installMode: config.RunnerInstallModeImage,
+			extraSpecs:  `{"runnerInstallMode": "userdata"}`,
+			osArch:      params.Amd64,
+			wantErr:     "runnerInstallMode userdata is invalid",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &config.ProviderConfig{
+				RunnerNamespace:     "runner",
+				RunnerInstallMode:   tc.installMode,
+				ToolsInstallerImage: "curlimages/curl:8.16.0",
+			}
+
+			client := fake.NewSimpleClientset()
+
+			p, _ := provider.NewKubernetesProvider(cfg, client, controllerID, poolID)
+
+			actual, err := p.CreateInstance(context.Background(), params.BootstrapInstance{
+				Name:          instanceName,
+				PoolID:        poolID,
+				Flavor:        "small",
+				RepoURL:       "https://github.com/testorg",
+				InstanceToken: "test-token",
+				Image:         "ubuntu:24.04",
+				OSType:        params.Linux,
+				OSArch:        tc.osArch,
+				Tools:         tools,
+				ExtraSpecs:    json.RawMessage(tc.extraSpecs),
+			})
+			if tc.wantErr != "" {
+				assert.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+
+			createdPod, err := client.CoreV1().Pods("runner").Get(context.Background(), actual.ProviderID, metav1.GetOptions{})
+			assert.NoError(t, err)
+
+			entrypoint, entrypointErr := client.CoreV1().ConfigMaps("runner").Get(context.Background(), providerID+"-entrypoint", metav1.GetOptions{})
+
+			if !tc.expectedInstaller {
+				assert.Empty(t, createdPod.Spec.InitContainers)
+				assert.Empty(t, createdPod.Spec.Containers[0].Command)
+				assert.True(t, apierrors.IsNotFound(entrypointErr))
+				return
+			}
+
+			assert.NoError(t, entrypointErr)
+			// the entrypoint sources the script next to it
+			assert.Contains(t, entrypoint.Data["entrypoint.sh"], "/ca-bundle.sh")
+			assert.Contains(t, entrypoint.Data, "ca-bundle.sh")
+			assert.Len(t, createdPod.Spec.InitContainers, 1)
+			installer := createdPod.Spec.InitContainers[0]
+			assert.Equal(t, "install-runner", installer.Name)
+			assert.Equal(t, "curlimages/curl:8.16.0", installer.Image)
+			assert.Contains(t, installer.Env, corev1.EnvVar{Name: "TOOLS_DOWNLOAD_URL", Value: tc.expectedToolsURL})
+			assert.Contains(t, installer.VolumeMounts, corev1.VolumeMount{Name: "runner", MountPath: "/runner"})
+
+			assert.Equal(t, []string{"/bin/bash", "/etc/garm/entrypoint/entrypoint.sh"}, createdPod.Spec.Containers[0].Command)
+			assert.Contains(t, createdPod.Spec.Containers[0].Env, corev1.EnvVar{Name: "RUNNER_ASSETS_DIR", Value: "/runner"})
+
+			runnerSecret, err := client.CoreV1().Secrets("runner").Get(context.Background(), providerID+"-credentials", metav1.GetOptions{})
+			assert.NoError(t, err)
+			if tc.expectedToolsToken == "" {
+				assert.NotContains(t, runnerSecret.Data, "TOOLS_DOWNLOAD_TOKEN")
+			} else {
+				assert.Equal(t, []byte(tc.expectedToolsToken), runnerSecret.Data["TOOLS_DOWNLOAD_TOKEN"])
+			}
+		})
+	}
+}
+
+func TestMultiCluster(t *testing.T) {
+	bootstrapParams := func(name, flavor, extraSpecs string) params.BootstrapInstance {
+		return params.BootstrapInstance{
+			Name:          name,
+			PoolID:        poolID,
+			Flavor:        flavor,
+			RepoURL:       "https://github.com/testorg",
+			InstanceToken: "test-token",
+			Image:         "localhost:5000/runner:ubuntu-22.04",
+			OSType:        "linux",
+			OSArch:        "arm64",
+			ExtraSpecs:    json.RawMessage(extraSpecs),
+		}
+	}
+
+	testCases := []struct {
+		name               string
+		bootstrapParams    params.BootstrapInstance
+		expectedCluster    string
+		expectedProviderID string
+		wantErr            string
+	}{
+		{
+			name:               "Pool without matching cluster runs in the default cluster",
+			bootstrapParams:    bootstrapParams("garm-Default", "small", ""),
+			expectedCluster:    "",
+			expectedProviderID: "garm-default",
+		},
+		{
+			name:               "Pool is routed by its flavor",
+			bootstrapParams:    bootstrapParams("garm-Flavor", "arm64-large", ""),
+			expectedCluster:    "arm",
+			expectedProviderID: "arm/garm-flavor",
+		},
+		{
+			name:               "Pool is routed by its extra_specs",
+			bootstrapParams:    bootstrapParams("garm-ExtraSpecs", "small", `{"cluster": "arm"}`),
+			expectedCluster:    "arm",
+			expectedProviderID: "arm/garm-extraspecs",
+		},
+		{
+			name:            "Pool is routed to an unknown cluster",
+			bootstrapParams: bootstrapParams("garm-Unknown", "small", `{"cluster": "gpu"}`),
+			wantErr:         "cluster gpu is not configured",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &config.ProviderConfig{
+				RunnerNamespace: "runner",
+			}
+
+			defaultClient := fake.NewSimpleClientset()
+			armClient := fake.NewSimpleClientset()
+			clients := map[string]*fake.Clientset{
+				"":    defaultClient,
+				"arm": armClient,
+			}
+			namespaces := map[string]string{
+				"":    "runner",
+				"arm": "arm-runner",
+			}
+
+			p, _ := provider.NewKubernetesProvider(cfg, defaultClient, controllerID, poolID, provider.Cluster{
+				Name:      "arm",
+				ClientSet: armClient,
+				Namespace: "arm-runner",
+				Flavors:   []string{"arm64-large"},
+			})
+
+			actual, err := p.CreateInstance(context.Background(), tc.bootstrapParams)
+			if tc.wantErr != "" {
+				assert.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedProviderID, actual.ProviderID)
+
+			podName := strings.ToLower(tc.bootstrapParams.Name)
+			for clusterName, client := range clients {
+				_, err := client.CoreV1().Pods(namespaces[clusterName]).Get(context.Background(), podName, metav1.GetOptions{})
+				assert.Equal(t, clusterName == tc.expectedCluster, err == nil, "pod in cluster %q", clusterName)
+			}
+
+			// instances are found by their ProviderID as well as by their name
+			for _, instance := range []string{actual.ProviderID, tc.bootstrapParams.Name} {
+				found, err := p.GetInstance(context.Background(), instance)
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedProviderID, found.ProviderID)
+			}
+
+			// a pod in the other cluster shows up in the list, too
+			_, err = p.CreateInstance(context.Background(), bootstrapParams("garm-Other", "arm64-large", ""))
+			assert.NoError(t, err)
+
+			instances, err := p.ListInstances(context.Background(), poolID)
+			assert.NoError(t, err)
+			providerIDs := []string{}
+			for _, instance := range instances {
+				providerIDs = append(providerIDs, instance.ProviderID)
+			}
+			assert.ElementsMatch(t, []string{tc.expectedProviderID, "arm/garm-other"}, providerIDs)
+
+			err = p.DeleteInstance(context.Background(), actual.ProviderID)
+			assert.NoError(t, err)
+			_, err = clients[tc.expectedCluster].CoreV1().Pods(namespaces[tc.expectedCluster]).Get(context.Background(), podName, metav1.GetOptions{})
+			assert.True(t, apierrors.IsNotFound(err))
+
+			err = p.RemoveAllInstances(context.Background())
+			assert.NoError(t, err)
+			instances, err = p.ListInstances(context.Background(), poolID)
+			assert.NoError(t, err)
+			assert.Empty(t, instances)
+		})
+	}
+}
+
+func TestCreateInstanceRetriesTransientErrors(t *testing.T) {
+	testCases := []struct {
+		name             string
+		errs             []error
+		expectedAttempts int
+		wantErr          string
+	}{
+		{
+			name: "Throttled and unavailable API server is retried",
+			errs: []error{
+				apierrors.NewTooManyRequests("throttled", 1),
+				apierrors.NewServiceUnavailable("unavailable"),
+			},
+			expectedAttempts: 3,
+		},
+		{
+			name: "Internal errors and timeouts are retried",
+			errs: []error{
+				apierrors.NewInternalError(errors.New("etcd leader changed")),
+				apierrors.NewTimeoutError("request timed out", 1),
+			},
+			expectedAttempts: 3,
+		},
+		{
+			name: "Retries are bounded",
+			errs: []error{
+				apierrors.NewServiceUnavailable("unavailable"),
+				apierrors.NewServiceUnavailable("unavailable"),
+				apierrors.NewServiceUnavailable("unavailable"),
+				apierrors.NewServiceUnavailable("unavailable"),
+				apierrors.NewServiceUnavailable("unavailable"),
+				apierrors.NewServiceUnavailable("unavailable"),
+			},
+			expectedAttempts: 5,
+			wantErr:          "unavailable",
+		},
+		{
+			name: "Invalid requests are not retried",
+			errs: []error{
+				apierrors.NewBadRequest("invalid pod"),
+			},
+			expectedAttempts: 1,
+			wantErr:          "invalid pod",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &config.ProviderConfig{
+				RunnerNamespace: "runner",
+			}
+
+			client := fake.NewSimpleClientset()
+			attempts := 0
+			client.PrependReactor("create", "pods", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+				attempts++
+				if attempts <= len(tc.errs) {
+					return true, nil, tc.errs[attempts-1]
+				}
+				return false, nil, nil
+			})
+
+			p, _ := provider.NewKubernetesProvider(cfg, client, controllerID, poolID)
+
+			_, err := p.CreateInstance(context.Background(), params.BootstrapInstance{
+				Name:          instanceName,
+				PoolID:        poolID,
+				Flavor:        "small",
+				RepoURL:       "https://github.com/testorg",
+				InstanceToken: "test-token",
+				Image:         "localhost:5000/runner:ubuntu-22.04",
+				OSType:        "linux",
+				OSArch:        "arm64",
+			})
+			if tc.wantErr != "" {
+				assert.ErrorContains(t, err, tc.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedAttempts, attempts)
+		})
+	}
+}
+
+func TestCreateInstanceHonorsContext(t *testing.T) {
+	testCases := []struct {
+		name             string
+		operationTimeout time.Duration
+		cancel           bool
+		wantErr          error
+	}{
+		{
+			name:    "Canceled context aborts retries",
+			cancel:  true,
+			wantErr: context.Canceled,
+		},
+		{
+			name:             "Operation timeout aborts retries",
+			operationTimeout: 150 * time.Millisecond,
+			wantErr:          context.DeadlineExceeded,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &config.ProviderConfig{
+				RunnerNamespace:  "runner",
+				OperationTimeout: tc.operationTimeout,
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			client := fake.NewSimpleClientset()
+			attempts := 0
+			client.PrependReactor("create", "pods", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+				attempts++
+				if tc.cancel {
+					cancel()
+				}
+				return true, nil, apierrors.NewServiceUnavailable("unavailable")
+			})
+
+			p, _ := provider.NewKubernetesProvider(cfg, client, controllerID, poolID)
+
+			_, err := p.CreateInstance(ctx, params.BootstrapInstance{
+				Name:          instanceName,
+				PoolID:        poolID,
+				Flavor:        "small",
+				RepoURL:       "https://github.com/testorg",
+				InstanceToken: "test-token",
+				Image:         "localhost:5000/runner:ubuntu-22.04",
+				OSType:        "linux",
+				OSArch:        "arm64",
+			})
+			assert.ErrorIs(t, err, tc.wantErr)
+			assert.Less(t, attempts, 5)
+
+			secrets, err := client.CoreV1().Secrets("runner").List(context.Background(), metav1.ListOptions{})
+			assert.NoError(t, err)
+			assert.Empty(t, secrets.Items)
+		})
+	}
+}
+
+func TestRemoveAllInstancesSweepsAuxiliaryObjects(t *testing.T) {
+	poolLabels := map[string]string{
+		spec.GarmInstanceNameLabel: instanceName,
+		spec.GarmPoolIDLabel:       poolID,
+		spec.GarmControllerIDLabel: controllerID,
+		spec.GarmPodNameLabel:      providerID,
+	}
+	otherPoolLabels := map[string]string{
+		spec.GarmInstanceNameLabel: "garm-other",
+		spec.GarmPoolIDLabel:       "other-pool",
+		spec.GarmControllerIDLabel: controllerID,
+		spec.GarmPodNameLabel:      "garm-other",
+	}
+
+	cfg := &config.ProviderConfig{
+		RunnerNamespace: "runner",
+	}
+
+	client := fake.NewSimpleClientset(
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: providerID + "-credentials", Namespace: "runner", Labels: poolLabels}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: providerID + "-config", Namespace: "runner", Labels: poolLabels}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "garm-other-credentials", Namespace: "runner", Labels: otherPoolLabels}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "unrelated", Namespace: "runner"}},
+	)
+
+	p, _ := provider.NewKubernetesProvider(cfg, client, controllerID, poolID)
+
+	err := p.RemoveAllInstances(context.Background())
+	assert.NoError(t, err)
+
+	secrets, err := client.CoreV1().Secrets("runner").List(context.Background(), metav1.ListOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, secrets.Items, 1)
+	assert.Equal(t, "garm-other-credentials", secrets.Items[0].Name)
+
+	configMaps, err := client.CoreV1().ConfigMaps("runner").List(context.Background(), metav1.ListOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, configMaps.Items, 1)
+	assert.Equal(t, "unrelated", configMaps.Items[0].Name)
+}
+
+func TestRemoveAllInstancesAggregatesErrors(t *testing.T) {
+	poolPod := func(name string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "runner",
+				Labels: map[string]string{
+					spec.GarmInstanceNameLabel: name,
+					spec.GarmPoolIDLabel:       poolID,
+					spec.GarmControllerIDLabel: controllerID,
+				},
+			},
+		}
+	}
+	runnerSecret := func(podName string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      spec.RunnerSecretName(podName),
+				Namespace: "runner",
+				Labels: map[string]string{
+					spec.GarmInstanceNameLabel: podName,
+					spec.GarmPoolIDLabel:       poolID,
+					spec.GarmControllerIDLabel: controllerID,
+					spec.GarmPodNameLabel:      podName,
+				},
+			},
+		}
+	}
+
+	testCases := []struct {
+		name             string
+		deleteErrors     map[string]error
+		keepPods         bool
+		wantErrs         []string
+		remainingPods    []string
+		remainingSecrets []string
+	}{
+		{
+			name: "All failed pods are reported",
+			deleteErrors: map[string]error{
+				"garm-runner-1": apierrors.NewForbidden(corev1.Resource("pods"), "garm-runner-1", errors.New("denied")),
+				"garm-runner-3": apierrors.NewBadRequest("invalid"),
+			},
+			wantErrs: []string{
+				"can not delete pod garm-runner-1 in namespace runner",
+				"can not delete pod garm-runner-3 in namespace runner",
+			},
+			remainingPods:    []string{"garm-runner-1", "garm-runner-3"},
+			remainingSecrets: []string{"garm-runner-1-credentials", "garm-runner-3-credentials"},
+		},
+		{
+			name: "Already deleted pods are no error",
+			deleteErrors: map[string]error{
+				"garm-runner-2": apierrors.NewNotFound(corev1.Resource("pods"), "garm-runner-2"),
+			},
+			remainingPods:    []string{"garm-runner-2"},
+			remainingSecrets: []string{},
+		},
+		{
+			name:     "Pods not gone within the timeout are reported",
+			keepPods: true,
+			wantErrs: []string{
+				"pods garm-runner-1, garm-runner-2, garm-runner-3 in namespace runner are not gone within 100ms",
+			},
+			remainingPods:    []string{"garm-runner-1", "garm-runner-2", "garm-runner-3"},
+			remainingSecrets: []string{"garm-runner-1-credentials", "garm-runner-2-credentials", "garm-runner-3-credentials"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &config.ProviderConfig{
+				RunnerNamespace:   "runner",
+				DeleteConcurrency: 2,
+				DeleteTimeout:     100 * time.Millisecond,
+			}
+
+			client := fake.NewSimpleClientset(
+				poolPod("garm-runner-1"),
+				poolPod("garm-runner-2"),
+				poolPod("garm-runner-3"),
+				runnerSecret("garm-runner-1"),
+				runnerSecret("garm-runner-2"),
+				runnerSecret("garm-runner-3"),
+			)
+			client.PrependReactor("delete", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				name := action.(k8stesting.DeleteAction).GetName()
+				if err, ok := tc.deleteErrors[name]; ok {
+					return true, nil, err
+				}
+				// the pod is terminating, but not gone yet
+				return tc.keepPods, nil, nil
+			})
+
+			p, _ := provider.NewKubernetesProvider(cfg, client, controllerID, poolID)
+
+			err := p.RemoveAllInstances(context.Background())
+			if len(tc.wantErrs) == 0 {
+				assert.NoError(t, err)
+			}
+			for _, wantErr := range tc.wantErrs {
+				assert.ErrorContains(t, err, wantErr)
+			}
+
+			pods, err := client.CoreV1().Pods("runner").List(context.Background(), metav1.ListOptions{})
+			assert.NoError(t, err)
+			remainingPods := []string{}
+			for _, pod := range pods.Items {
+				remainingPods = append(remainingPods, pod.Name)
+			}
+			assert.ElementsMatch(t, tc.remainingPods, remainingPods)
+
+			// auxiliary objects of pods which still exist are not swept
+			secrets, err := client.CoreV1().Secrets("runner").List(context.Background(), metav1.ListOptions{})
+			assert.NoError(t, err)
+			remainingSecrets := []string{}
+			for _, secret := range secrets.Items {
+				remainingSecrets = append(remainingSecrets, secret.Name)
+			}
+			assert.ElementsMatch(t, tc.remainingSecrets, remainingSecrets)
+		})
+	}
+}
+
+func TestCreateInstanceWaitForPodStartup(t *testing.T) {
+	bootstrapParams := params.BootstrapInstance{
+		Name:          instanceName,
+		PoolID:        poolID,
+		Flavor:        "small",
+		RepoURL:       "https://github.com/testorg",
+		InstanceToken: "test-token",
+		MetadataURL:   "https://metadata.test",
+		CallbackURL:   "https://callback.test/status",
+		Image:         "localhost:5000/runner:ubuntu-22.04",
+		OSType:        "linux",
+		OSArch:        "arm64",
+	}
+
+	testCases := []struct {
+		name      string
+		podStatus *corev1.PodStatus
+		wantErr   string
+	}{
+		{
+			name: "Runner container started",
+			podStatus: &corev1.PodStatus{
+				Phase: corev1.PodRunning,
+				Conditions: []corev1.PodCondition{
+					{Type: corev1.PodScheduled, Status: corev1.ConditionTrue},
+				},
+				ContainerStatuses: []corev1.ContainerStatus{
+					{Name: "runner", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+				},
+			},
+		},
+		{
+			name: "Runner image can not be pulled",
+			podStatus: &corev1.PodStatus{
+				Phase: corev1.PodPending,
+				Conditions: []corev1.PodCondition{
+					{Type: corev1.PodScheduled, Status: corev1.ConditionTrue},
+				},
+				ContainerStatuses: []corev1.ContainerStatus{
+					{Name: "runner", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{
+						Reason:  "ErrImagePull",
+						Message: "manifest unknown",
+					}}},
+				},
+			},
+			wantErr: "container runner: ErrImagePull: manifest unknown",
+		},
+		{
+			name: "Pod is not schedulable",
+			podStatus: &corev1.PodStatus{
+				Phase: corev1.PodPending,
+				Conditions: []corev1.PodCondition{
+					{
+						Type:    corev1.PodScheduled,
+						Status:  corev1.ConditionFalse,
+						Reason:  "Unschedulable",
+						Message: "0/3 nodes are available: 3 Insufficient cpu.",
+					},
+				},
+			},
+			wantErr: "Unschedulable: 0/3 nodes are available: 3 Insufficient cpu.",
+		},
+		{
+			name:    "Pod status is never reported",
+			wantErr: "pod has no status yet",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &config.ProviderConfig{
+				RunnerNamespace: "runner",
+				PodReadyTimeout: 500 * time.Millisecond,
+			}
+
+			client := fake.NewSimpleClientset()
+
+			p, _ := provider.NewKubernetesProvider(cfg, client, controllerID, poolID)
+
+			// simulate the kubelet by reporting the pod status once the pod got created
+			if tc.podStatus != nil {
+				go func() {
+					for {
+						pod, err := client.CoreV1().Pods("runner").Get(context.Background(), providerID, metav1.GetOptions{})
+						if err == nil {
+							pod.Status = *tc.podStatus
+							_, _ = client.CoreV1().Pods("runner").UpdateStatus(context.Background(), pod, metav1.UpdateOptions{})
+							return
+						}
+						time.Sleep(10 * time.Millisecond)
+					}
+				}()
+			}
+
+			actual, err := p.CreateInstance(context.Background(), bootstrapParams)
+			if tc.wantErr != "" {
+				assert.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, params.InstanceRunning, actual.Status)
+		})
+	}
+}
+
+func TestGetInstance(t *testing.T) {
+	testCases := []struct {
+		name                     string
+		config                   *config.ProviderConfig
+		expectedProviderInstance params.ProviderInstance
+		runtimeObjects           []runtime.Object
+		wantErr                  error
+	}{
+		{
+			name: "Get Instance",
+			config: &config.ProviderConfig{
+				KubeConfigPath:  "",
+				RunnerNamespace: "runner",
+			},
+			expectedProviderInstance: params.ProviderInstance{
+				ProviderID: providerID,
+				Name:       instanceName,
+				OSType:     "linux",
+				OSName:     "",
+				OSVersion:  "",
+				OSArch:     "arm64",
+				Status:     "running",
+			},
+			runtimeObjects: []runtime.Object{
+				&corev1.Pod{
+					TypeMeta: metav1.TypeMeta{
+						Kind:       "Pod",
+						APIVersion: "v1",
+					},
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      providerID,
+						Namespace: "runner",
+						Labels: map[string]string{
 							spec.GarmInstanceNameLabel: instanceName,
 							spec.GarmFlavorLabel:       "small",
 							spec.GarmOSArchLabel:       "arm64",
@@ -1773,20 +3652,306 @@ func TestGetInstance(t *testing.T) {
 							},
 						},
 					},
-					Status: corev1.PodStatus{
-						Phase: "Running",
+					Status: corev1.PodStatus{
+						Phase: "Running",
+					},
+				},
+			},
+		},
+		{
+			name: "Get Instance with crashing runner container",
+			config: &config.ProviderConfig{
+				KubeConfigPath:  "",
+				RunnerNamespace: "runner",
+			},
+			expectedProviderInstance: params.ProviderInstance{
+				ProviderID:    providerID,
+				Name:          instanceName,
+				OSType:        "linux",
+				OSArch:        "arm64",
+				Status:        "error",
+				ProviderFault: []byte("container runner: CrashLoopBackOff: back-off 5m0s restarting failed container"),
+			},
+			runtimeObjects: []runtime.Object{
+				&corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      providerID,
+						Namespace: "runner",
+						Labels: map[string]string{
+							spec.GarmInstanceNameLabel: instanceName,
+							spec.GarmOSArchLabel:       "arm64",
+							spec.GarmOSTypeLabel:       "linux",
+							spec.GarmPoolIDLabel:       poolID,
+							spec.GarmControllerIDLabel: controllerID,
+						},
+					},
+					Status: corev1.PodStatus{
+						Phase: corev1.PodRunning,
+						ContainerStatuses: []corev1.ContainerStatus{
+							{
+								Name: "runner",
+								State: corev1.ContainerState{
+									Waiting: &corev1.ContainerStateWaiting{
+										Reason:  "CrashLoopBackOff",
+										Message: "back-off 5m0s restarting failed container",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "Get Instance with image pull failure",
+			config: &config.ProviderConfig{
+				KubeConfigPath:  "",
+				RunnerNamespace: "runner",
+			},
+			expectedProviderInstance: params.ProviderInstance{
+				ProviderID:    providerID,
+				Name:          instanceName,
+				OSType:        "linux",
+				OSArch:        "arm64",
+				Status:        "error",
+				ProviderFault: []byte("container runner: ImagePullBackOff: Back-off pulling image"),
+			},
+			runtimeObjects: []runtime.Object{
+				&corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      providerID,
+						Namespace: "runner",
+						Labels: map[string]string{
+							spec.GarmInstanceNameLabel: instanceName,
+							spec.GarmOSArchLabel:       "arm64",
+							spec.GarmOSTypeLabel:       "linux",
+							spec.GarmPoolIDLabel:       poolID,
+							spec.GarmControllerIDLabel: controllerID,
+						},
+					},
+					Status: corev1.PodStatus{
+						Phase: corev1.PodPending,
+						ContainerStatuses: []corev1.ContainerStatus{
+							{
+								Name: "runner",
+								State: corev1.ContainerState{
+									Waiting: &corev1.ContainerStateWaiting{
+										Reason:  "ImagePullBackOff",
+										Message: "Back-off pulling image",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "Get Instance with OOMKilled runner container",
+			config: &config.ProviderConfig{
+				KubeConfigPath:  "",
+				RunnerNamespace: "runner",
+			},
+			expectedProviderInstance: params.ProviderInstance{
+				ProviderID:    providerID,
+				Name:          instanceName,
+				OSType:        "linux",
+				OSArch:        "arm64",
+				Status:        "error",
+				ProviderFault: []byte("container runner terminated with exit code 137: OOMKilled"),
+			},
+			runtimeObjects: []runtime.Object{
+				&corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      providerID,
+						Namespace: "runner",
+						Labels: map[string]string{
+							spec.GarmInstanceNameLabel: instanceName,
+							spec.GarmOSArchLabel:       "arm64",
+							spec.GarmOSTypeLabel:       "linux",
+							spec.GarmPoolIDLabel:       poolID,
+							spec.GarmControllerIDLabel: controllerID,
+						},
+					},
+					Status: corev1.PodStatus{
+						Phase: corev1.PodRunning,
+						ContainerStatuses: []corev1.ContainerStatus{
+							{
+								Name: "runner",
+								State: corev1.ContainerState{
+									Terminated: &corev1.ContainerStateTerminated{
+										Reason:   "OOMKilled",
+										ExitCode: 137,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "Get Instance of evicted pod",
+			config: &config.ProviderConfig{
+				KubeConfigPath:  "",
+				RunnerNamespace: "runner",
+			},
+			expectedProviderInstance: params.ProviderInstance{
+				ProviderID:    providerID,
+				Name:          instanceName,
+				OSType:        "linux",
+				OSArch:        "arm64",
+				Status:        "error",
+				ProviderFault: []byte("Evicted: The node was low on resource: memory."),
+			},
+			runtimeObjects: []runtime.Object{
+				&corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      providerID,
+						Namespace: "runner",
+						Labels: map[string]string{
+							spec.GarmInstanceNameLabel: instanceName,
+							spec.GarmOSArchLabel:       "arm64",
+							spec.GarmOSTypeLabel:       "linux",
+							spec.GarmPoolIDLabel:       poolID,
+							spec.GarmControllerIDLabel: controllerID,
+						},
+					},
+					Status: corev1.PodStatus{
+						Phase:   corev1.PodFailed,
+						Reason:  "Evicted",
+						Message: "The node was low on resource: memory.",
+					},
+				},
+			},
+		},
+		{
+			name: "Get Instance of unschedulable pod",
+			config: &config.ProviderConfig{
+				KubeConfigPath:  "",
+				RunnerNamespace: "runner",
+			},
+			expectedProviderInstance: params.ProviderInstance{
+				ProviderID:    providerID,
+				Name:          instanceName,
+				OSType:        "linux",
+				OSArch:        "arm64",
+				Status:        "pending_create",
+				ProviderFault: []byte("Unschedulable: 0/3 nodes are available: 3 Insufficient cpu."),
+			},
+			runtimeObjects: []runtime.Object{
+				&corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      providerID,
+						Namespace: "runner",
+						Labels: map[string]string{
+							spec.GarmInstanceNameLabel: instanceName,
+							spec.GarmOSArchLabel:       "arm64",
+							spec.GarmOSTypeLabel:       "linux",
+							spec.GarmPoolIDLabel:       poolID,
+							spec.GarmControllerIDLabel: controllerID,
+						},
+					},
+					Status: corev1.PodStatus{
+						Phase: corev1.PodPending,
+						Conditions: []corev1.PodCondition{
+							{
+								Type:    corev1.PodScheduled,
+								Status:  corev1.ConditionFalse,
+								Reason:  "Unschedulable",
+								Message: "0/3 nodes are available: 3 Insufficient cpu.",
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "Get Instance with warning events",
+			config: &config.ProviderConfig{
+				KubeConfigPath:  "",
+				RunnerNamespace: "runner",
+			},
+			expectedProviderInstance: params.ProviderInstance{
+				ProviderID:    providerID,
+				Name:          instanceName,
+				OSType:        "linux",
+				OSArch:        "arm64",
+				Status:        "pending_create",
+				ProviderFault: []byte("FailedMount (x4): MountVolume.SetUp failed for volume \"cache\": configmap \"cache\" not found; FailedScheduling: 0/3 nodes are available: 3 Insufficient memory."),
+			},
+			runtimeObjects: []runtime.Object{
+				&corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      providerID,
+						Namespace: "runner",
+						Labels: map[string]string{
+							spec.GarmInstanceNameLabel: instanceName,
+							spec.GarmOSArchLabel:       "arm64",
+							spec.GarmOSTypeLabel:       "linux",
+							spec.GarmPoolIDLabel:       poolID,
+							spec.GarmControllerIDLabel: controllerID,
+						},
+					},
+					Status: corev1.PodStatus{
+						Phase: corev1.PodPending,
+					},
+				},
+				&corev1.Event{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      providerID + ".scheduling",
+						Namespace: "runner",
+					},
+					InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: providerID},
+					Type:           corev1.EventTypeWarning,
+					Reason:         "FailedScheduling",
+					Message:        "0/3 nodes are available: 3 Insufficient memory.",
+					LastTimestamp:  metav1.NewTime(time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)),
+				},
+				&corev1.Event{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      providerID + ".mount",
+						Namespace: "runner",
+					},
+					InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: providerID},
+					Type:           corev1.EventTypeWarning,
+					Reason:         "FailedMount",
+					Message:        "MountVolume.SetUp failed for volume \"cache\": configmap \"cache\" not found",
+					Count:          4,
+					LastTimestamp:  metav1.NewTime(time.Date(2024, 1, 1, 10, 5, 0, 0, time.UTC)),
+				},
+				&corev1.Event{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      providerID + ".scheduled",
+						Namespace: "runner",
+					},
+					InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: providerID},
+					Type:           corev1.EventTypeNormal,
+					Reason:         "Scheduled",
+					Message:        "Successfully assigned runner/" + providerID + " to worker-1",
+					LastTimestamp:  metav1.NewTime(time.Date(2024, 1, 1, 10, 6, 0, 0, time.UTC)),
+				},
+				&corev1.Event{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "other-pod.backoff",
+						Namespace: "runner",
 					},
+					InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: "other-pod"},
+					Type:           corev1.EventTypeWarning,
+					Reason:         "BackOff",
+					Message:        "Back-off restarting failed container",
+					LastTimestamp:  metav1.NewTime(time.Date(2024, 1, 1, 10, 7, 0, 0, time.UTC)),
 				},
 			},
 		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			config.Config = *tc.config
+			cfg := tc.config
 
 			client := fake.NewSimpleClientset(tc.runtimeObjects...)
 
-			p, _ := provider.NewKubernetesProvider(client, controllerID, poolID)
+			p, _ := provider.NewKubernetesProvider(cfg, client, controllerID, poolID)
 
 			actual, err := p.GetInstance(context.Background(), instanceName)
 
@@ -1796,6 +3961,109 @@ func TestGetInstance(t *testing.T) {
 	}
 }
 
+func TestListInstancesListsEventsOfUnhealthyPods(t *testing.T) {
+	runnerPod := func(name string, phase corev1.PodPhase, conditions ...corev1.PodCondition) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      strings.ToLower(name),
+				Namespace: "runner",
+				Labels: map[string]string{
+					spec.GarmInstanceNameLabel: name,
+					spec.GarmPoolIDLabel:       poolID,
+					spec.GarmControllerIDLabel: controllerID,
+				},
+			},
+			Status: corev1.PodStatus{
+				Phase:      phase,
+				Conditions: conditions,
+			},
+		}
+	}
+	warningEvent := func(podName, reason string) *corev1.Event {
+		return &corev1.Event{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      podName + "." + strings.ToLower(reason),
+				Namespace: "runner",
+			},
+			InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: podName},
+			Type:           corev1.EventTypeWarning,
+			Reason:         reason,
+			Message:        reason + " of " + podName,
+		}
+	}
+	unschedulable := corev1.PodCondition{
+		Type:    corev1.PodScheduled,
+		Status:  corev1.ConditionFalse,
+		Reason:  corev1.PodReasonUnschedulable,
+		Message: "0/3 nodes are available",
+	}
+
+	testCases := []struct {
+		name                   string
+		runtimeObjects         []runtime.Object
+		expectedFaults         map[string]string
+		expectedEventSelectors []string
+	}{
+		{
+			name: "events are listed once for all pods",
+			runtimeObjects: []runtime.Object{
+				runnerPod("garm-Unschedulable", corev1.PodPending, unschedulable),
+				runnerPod("garm-Failed", corev1.PodFailed),
+				runnerPod("garm-Starting", corev1.PodPending),
+				runnerPod("garm-Running", corev1.PodRunning),
+				warningEvent("garm-unschedulable", "FailedScheduling"),
+				warningEvent("garm-failed", "BackOff"),
+				warningEvent("garm-starting", "FailedMount"),
+				warningEvent("garm-running", "Unhealthy"),
+			},
+			expectedFaults: map[string]string{
+				"garm-Unschedulable": "Unschedulable: 0/3 nodes are available; FailedScheduling: FailedScheduling of garm-unschedulable",
+				"garm-Failed":        "BackOff: BackOff of garm-failed",
+				"garm-Starting":      "",
+				"garm-Running":       "",
+			},
+			expectedEventSelectors: []string{"involvedObject.kind=Pod,type=Warning"},
+		},
+		{
+			name: "no events are listed for pods starting up",
+			runtimeObjects: []runtime.Object{
+				runnerPod("garm-Starting", corev1.PodPending),
+				runnerPod("garm-Running", corev1.PodRunning),
+				warningEvent("garm-starting", "FailedMount"),
+			},
+			expectedFaults: map[string]string{
+				"garm-Starting": "",
+				"garm-Running":  "",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset(tc.runtimeObjects...)
+
+			p, _ := provider.NewKubernetesProvider(&config.ProviderConfig{RunnerNamespace: "runner"}, client, controllerID, poolID)
+
+			instances, err := p.ListInstances(context.Background(), poolID)
+			assert.NoError(t, err)
+
+			faults := map[string]string{}
+			for _, instance := range instances {
+				faults[instance.Name] = string(instance.ProviderFault)
+			}
+			assert.Equal(t, tc.expectedFaults, faults)
+
+			var eventSelectors []string
+			for _, action := range client.Actions() {
+				if listAction, ok := action.(k8stesting.ListAction); ok && action.GetResource().Resource == "events" {
+					eventSelectors = append(eventSelectors, listAction.GetListRestrictions().Fields.String())
+				}
+			}
+			assert.Equal(t, tc.expectedEventSelectors, eventSelectors)
+		})
+	}
+}
+
 func TestDeleteInstance(t *testing.T) {
 	testCases := []struct {
 		name                     string
@@ -1931,13 +4199,13 @@ func TestDeleteInstance(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			// create the provider config
-			config.Config = *tc.config
+			cfg := tc.config
 
 			// create a fake kubernetes client
 			client := fake.NewSimpleClientset(tc.runtimeObjects...)
 
 			// initialize the provider
-			p, _ := provider.NewKubernetesProvider(client, controllerID, poolID)
+			p, _ := provider.NewKubernetesProvider(cfg, client, controllerID, poolID)
 
 			labels := make(map[string]string)
 			labels[spec.GarmPoolIDLabel] = spec.ToValidLabel(poolID)
@@ -1948,7 +4216,7 @@ func TestDeleteInstance(t *testing.T) {
 			// get all pods in the configured namespace
 			pods, err := p.ClientSet.
 				CoreV1().
-				Pods(config.Config.RunnerNamespace).
+				Pods(cfg.RunnerNamespace).
 				List(context.Background(), metav1.ListOptions{
 					LabelSelector: labelSelectorStr.String(),
 				})
@@ -1962,7 +4230,7 @@ func TestDeleteInstance(t *testing.T) {
 			if tc.wantErr == nil && err == nil {
 				pods, err := p.ClientSet.
 					CoreV1().
-					Pods(config.Config.RunnerNamespace).
+					Pods(cfg.RunnerNamespace).
 					List(context.Background(), metav1.ListOptions{
 						LabelSelector: labelSelectorStr.String(),
 					})
@@ -1973,6 +4241,304 @@ func TestDeleteInstance(t *testing.T) {
 	}
 }
 
+func TestDeleteInstanceListsOnlyCreatedAuxiliaryKinds(t *testing.T) {
+	client := fake.NewSimpleClientset(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      providerID,
+			Namespace: "runner",
+			Labels: map[string]string{
+				spec.GarmInstanceNameLabel: instanceName,
+				spec.GarmPoolIDLabel:       poolID,
+				spec.GarmControllerIDLabel: controllerID,
+			},
+		},
+	})
+
+	p, _ := provider.NewKubernetesProvider(&config.ProviderConfig{RunnerNamespace: "runner"}, client, controllerID, poolID)
+
+	err := p.DeleteInstance(context.Background(), instanceName)
+	assert.NoError(t, err)
+
+	// the provider may not be allowed to list kinds it never creates
+	listedKinds := map[string]bool{}
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "list" {
+			listedKinds[action.GetResource().Resource] = true
+		}
+	}
+	assert.Equal(t, map[string]bool{"pods": true, "secrets": true, "configmaps": true}, listedKinds)
+}
+
+func TestDeleteInstanceDeleteOptions(t *testing.T) {
+	runnerPod := func(nodeName string, terminatingFor time.Duration) *corev1.Pod {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      providerID,
+				Namespace: "runner",
+				Labels: map[string]string{
+					spec.GarmInstanceNameLabel: instanceName,
+					spec.GarmPoolIDLabel:       poolID,
+					spec.GarmControllerIDLabel: controllerID,
+				},
+			},
+			Spec: corev1.PodSpec{
+				NodeName: nodeName,
+			},
+		}
+		if terminatingFor > 0 {
+			pod.DeletionGracePeriodSeconds = ptr.To[int64](30)
+			pod.DeletionTimestamp = ptr.To(metav1.NewTime(time.Now().Add(30*time.Second - terminatingFor)))
+		}
+		return pod
+	}
+	node := func(status corev1.ConditionStatus) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "node-1",
+			},
+			Status: corev1.NodeStatus{
+				Conditions: []corev1.NodeCondition{
+					{Type: corev1.NodeReady, Status: status},
+				},
+			},
+		}
+	}
+	gracefulConfig := config.ProviderConfig{
+		RunnerNamespace:           "runner",
+		GracePeriodSeconds:        ptr.To[int64](300),
+		PropagationPolicy:         "Foreground",
+		ForceDeleteAfter:          5 * time.Minute,
+		ForceDeleteOnNodeNotReady: true,
+	}
+
+	testCases := []struct {
+		name                  string
+		config                config.ProviderConfig
+		runtimeObjects        []runtime.Object
+		wantGracePeriod       *int64
+		wantPropagationPolicy *metav1.DeletionPropagation
+	}{
+		{
+			name: "Default delete options",
+			config: config.ProviderConfig{
+				RunnerNamespace: "runner",
+			},
+			runtimeObjects: []runtime.Object{runnerPod("node-1", 0)},
+		},
+		{
+			name:                  "Configured grace period and propagation policy",
+			config:                gracefulConfig,
+			runtimeObjects:        []runtime.Object{runnerPod("node-1", 0), node(corev1.ConditionTrue)},
+			wantGracePeriod:       ptr.To[int64](300),
+			wantPropagationPolicy: ptr.To(metav1.DeletePropagationForeground),
+		},
+		{
+			name:                  "Pod terminating shorter than the threshold",
+			config:                gracefulConfig,
+			runtimeObjects:        []runtime.Object{runnerPod("node-1", time.Minute), node(corev1.ConditionTrue)},
+			wantGracePeriod:       ptr.To[int64](300),
+			wantPropagationPolicy: ptr.To(metav1.DeletePropagationForeground),
+		},
+		{
+			name:                  "Pod terminating longer than the threshold is force deleted",
+			config:                gracefulConfig,
+			runtimeObjects:        []runtime.Object{runnerPod("node-1", 10*time.Minute), node(corev1.ConditionTrue)},
+			wantGracePeriod:       ptr.To[int64](0),
+			wantPropagationPolicy: ptr.To(metav1.DeletePropagationForeground),
+		},
+		{
+			name:                  "Pod on a NotReady node is force deleted",
+			config:                gracefulConfig,
+			runtimeObjects:        []runtime.Object{runnerPod("node-1", 0), node(corev1.ConditionUnknown)},
+			wantGracePeriod:       ptr.To[int64](0),
+			wantPropagationPolicy: ptr.To(metav1.DeletePropagationForeground),
+		},
+		{
+			name:                  "Pod on a deleted node is force deleted",
+			config:                gracefulConfig,
+			runtimeObjects:        []runtime.Object{runnerPod("node-1", 0)},
+			wantGracePeriod:       ptr.To[int64](0),
+			wantPropagationPolicy: ptr.To(metav1.DeletePropagationForeground),
+		},
+		{
+			name: "Grace period does not cut the deregistration short",
+			config: config.ProviderConfig{
+				RunnerNamespace:       "runner",
+				GracePeriodSeconds:    ptr.To[int64](5),
+				DeregistrationCommand: []string{"/runner/deregister.sh"},
+				DeregistrationTimeout: 2 * time.Minute,
+			},
+			runtimeObjects:  []runtime.Object{runnerPod("node-1", 0)},
+			wantGracePeriod: ptr.To[int64](120),
+		},
+		{
+			name: "Grace period longer than the deregistration is kept",
+			config: config.ProviderConfig{
+				RunnerNamespace:       "runner",
+				GracePeriodSeconds:    ptr.To[int64](300),
+				DeregistrationCommand: []string{"/runner/deregister.sh"},
+				DeregistrationTimeout: 2 * time.Minute,
+			},
+			runtimeObjects:  []runtime.Object{runnerPod("node-1", 0)},
+			wantGracePeriod: ptr.To[int64](300),
+		},
+		{
+			name:                  "Unscheduled pod is deleted gracefully",
+			config:                gracefulConfig,
+			runtimeObjects:        []runtime.Object{runnerPod("", 0)},
+			wantGracePeriod:       ptr.To[int64](300),
+			wantPropagationPolicy: ptr.To(metav1.DeletePropagationForeground),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &tc.config
+
+			client := fake.NewSimpleClientset(tc.runtimeObjects...)
+			var deleteOptions *metav1.DeleteOptions
+			client.PrependReactor("delete", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				deleteOptions = ptr.To(action.(k8stesting.DeleteActionImpl).GetDeleteOptions())
+				return false, nil, nil
+			})
+
+			p, _ := provider.NewKubernetesProvider(cfg, client, controllerID, poolID)
+
+			err := p.DeleteInstance(context.Background(), providerID)
+			assert.NoError(t, err)
+
+			if assert.NotNil(t, deleteOptions) {
+				assert.Equal(t, tc.wantGracePeriod, deleteOptions.GracePeriodSeconds)
+				assert.Equal(t, tc.wantPropagationPolicy, deleteOptions.PropagationPolicy)
+			}
+		})
+	}
+}
+
+func TestDeregistrationHook(t *testing.T) {
+	testCases := []struct {
+		name                  string
+		deregistrationTimeout time.Duration
+		gracePeriodSeconds    *int64
+		deletePoolID          string
+		keepPod               bool
+		getErr                error
+		wantGracePeriod       *int64
+		wantErr               string
+		wantPods              int
+	}{
+		{
+			name:                  "Delete waits for the runner to deregister",
+			deregistrationTimeout: 100 * time.Millisecond,
+			deletePoolID:          poolID,
+		},
+		{
+			name:                  "Delete waits for the grace period of the pod and a margin",
+			deregistrationTimeout: 100 * time.Millisecond,
+			deletePoolID:          poolID,
+			keepPod:               true,
+			wantErr:               "are not gone within 40s",
+			wantPods:              1,
+		},
+		{
+			name:                  "Delete waits for the grace period of the delete call and a margin",
+			deregistrationTimeout: 100 * time.Millisecond,
+			gracePeriodSeconds:    ptr.To[int64](300),
+			deletePoolID:          poolID,
+			keepPod:               true,
+			wantErr:               "are not gone within 5m10s",
+			wantPods:              1,
+		},
+		{
+			name:                  "Delete waits for the pod without knowing its pool",
+			deregistrationTimeout: 100 * time.Millisecond,
+			keepPod:               true,
+			wantErr:               "are not gone within 40s",
+			wantPods:              1,
+		},
+		{
+			name:                  "Delete fails on errors which are not retriable",
+			deregistrationTimeout: time.Minute,
+			deletePoolID:          poolID,
+			keepPod:               true,
+			getErr:                apierrors.NewForbidden(corev1.Resource("pods"), providerID, errors.New("forbidden")),
+			wantGracePeriod:       ptr.To[int64](60),
+			wantErr:               "can not check if pods " + providerID + " in namespace runner are gone",
+			wantPods:              1,
+		},
+		{
+			name:                  "Long deregistration raises the grace period",
+			deregistrationTimeout: 90 * time.Second,
+			deletePoolID:          poolID,
+			wantGracePeriod:       ptr.To[int64](90),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &config.ProviderConfig{
+				RunnerNamespace:       "runner",
+				DeregistrationCommand: []string{"/bin/sh", "-c", "/runner/deregister.sh"},
+				DeregistrationTimeout: tc.deregistrationTimeout,
+				GracePeriodSeconds:    tc.gracePeriodSeconds,
+			}
+
+			client := fake.NewSimpleClientset()
+			deleted := false
+			client.PrependReactor("delete", "pods", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+				deleted = true
+				// the pod is terminating, but not gone yet
+				return tc.keepPod, nil, nil
+			})
+			client.PrependReactor("get", "pods", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+				if deleted && tc.getErr != nil {
+					return true, nil, tc.getErr
+				}
+				return false, nil, nil
+			})
+
+			p, _ := provider.NewKubernetesProvider(cfg, client, controllerID, poolID)
+
+			_, err := p.CreateInstance(context.Background(), params.BootstrapInstance{
+				Name:          instanceName,
+				PoolID:        poolID,
+				Flavor:        "small",
+				RepoURL:       "https://github.com/testorg",
+				InstanceToken: "test-token",
+				Image:         "localhost:5000/runner:ubuntu-22.04",
+				OSType:        "linux",
+				OSArch:        "arm64",
+			})
+			assert.NoError(t, err)
+
+			pod, err := client.CoreV1().Pods("runner").Get(context.Background(), providerID, metav1.GetOptions{})
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantGracePeriod, pod.Spec.TerminationGracePeriodSeconds)
+			if assert.NotNil(t, pod.Spec.Containers[0].Lifecycle) && assert.NotNil(t, pod.Spec.Containers[0].Lifecycle.PreStop) {
+				assert.Equal(t, &corev1.ExecAction{
+					Command: []string{"/bin/sh", "-c", "/runner/deregister.sh"},
+				}, pod.Spec.Containers[0].Lifecycle.PreStop.Exec)
+			}
+
+			// garm does not pass the pool to DeleteInstance
+			p, _ = provider.NewKubernetesProvider(cfg, client, controllerID, tc.deletePoolID)
+			// the deadline cuts the wait for pods which are kept short
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+			err = p.DeleteInstance(ctx, providerID)
+			if tc.wantErr != "" {
+				assert.ErrorContains(t, err, tc.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			pods, err := client.CoreV1().Pods("runner").List(context.Background(), metav1.ListOptions{})
+			assert.NoError(t, err)
+			assert.Len(t, pods.Items, tc.wantPods)
+		})
+	}
+}
+
 func TestRemoveAllInstances(t *testing.T) {
 	testCases := []struct {
 		name           string
@@ -2220,11 +4786,11 @@ func TestRemoveAllInstances(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			config.Config = *tc.config
+			cfg := tc.config
 
 			client := fake.NewSimpleClientset(tc.runtimeObjects...)
 
-			p, _ := provider.NewKubernetesProvider(client, controllerID, poolID)
+			p, _ := provider.NewKubernetesProvider(cfg, client, controllerID, poolID)
 
 			labels := make(map[string]string)
 			labels[spec.GarmPoolIDLabel] = spec.ToValidLabel(poolID)
@@ -2234,7 +4800,7 @@ func TestRemoveAllInstances(t *testing.T) {
 
 			pods, err := p.ClientSet.
 				CoreV1().
-				Pods(config.Config.RunnerNamespace).
+				Pods(cfg.RunnerNamespace).
 				List(context.Background(), metav1.ListOptions{
 					LabelSelector: labelSelectorStr.String(),
 				})
@@ -2247,7 +4813,7 @@ func TestRemoveAllInstances(t *testing.T) {
 			if tc.wantErr == nil && err == nil {
 				pods, err := p.ClientSet.
 					CoreV1().
-					Pods(config.Config.RunnerNamespace).
+					Pods(cfg.RunnerNamespace).
 					List(context.Background(), metav1.ListOptions{
 						LabelSelector: labelSelectorStr.String(),
 					})
@@ -2258,6 +4824,215 @@ func TestRemoveAllInstances(t *testing.T) {
 	}
 }
 
+func TestStopInstance(t *testing.T) {
+	runnerPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      providerID,
+			Namespace: "runner",
+			Labels: map[string]string{
+				spec.GarmInstanceNameLabel: instanceName,
+				spec.GarmOSArchLabel:       "arm64",
+				spec.GarmOSTypeLabel:       "linux",
+				spec.GarmPoolIDLabel:       poolID,
+				spec.GarmControllerIDLabel: controllerID,
+			},
+			Annotations: map[string]string{
+				spec.GarmPodSpecAnnotation: `{"containers":[{"name":"runner","image":"localhost:5000/runner:ubuntu-22.04"}],"restartPolicy":"Never"}`,
+			},
+		},
+		Spec: corev1.PodSpec{
+			NodeName:      "worker-1",
+			RestartPolicy: corev1.RestartPolicyNever,
+			Containers: []corev1.Container{
+				{
+					Name:  "runner",
+					Image: "localhost:5000/runner:ubuntu-22.04",
+				},
+			},
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+		},
+	}
+	parkedConfigMap, err := spec.PodToParkedConfigMap(runnerPod)
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		name                     string
+		config                   *config.ProviderConfig
+		runtimeObjects           []runtime.Object
+		expectedProviderInstance params.ProviderInstance
+		wantErr                  bool
+	}{
+		{
+			name: "Stop running instance",
+			config: &config.ProviderConfig{
+				RunnerNamespace: "runner",
+			},
+			runtimeObjects: []runtime.Object{
+				runnerPod.DeepCopy(),
+				spec.NewRunnerSecret(runnerPod, params.BootstrapInstance{InstanceToken: "test-token"}),
+			},
+			expectedProviderInstance: params.ProviderInstance{
+				ProviderID: providerID,
+				Name:       instanceName,
+				OSType:     "linux",
+				OSArch:     "arm64",
+				Status:     params.InstanceStopped,
+			},
+		},
+		{
+			name: "Stop already stopped instance",
+			config: &config.ProviderConfig{
+				RunnerNamespace: "runner",
+			},
+			runtimeObjects: []runtime.Object{parkedConfigMap.DeepCopy()},
+			expectedProviderInstance: params.ProviderInstance{
+				ProviderID: providerID,
+				Name:       instanceName,
+				OSType:     "linux",
+				OSArch:     "arm64",
+				Status:     params.InstanceStopped,
+			},
+		},
+		{
+			name: "Stop unknown instance",
+			config: &config.ProviderConfig{
+				RunnerNamespace: "runner",
+			},
+			runtimeObjects: []runtime.Object{},
+			wantErr:        true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := tc.config
+
+			client := fake.NewSimpleClientset(tc.runtimeObjects...)
+
+			p, _ := provider.NewKubernetesProvider(cfg, client, controllerID, poolID)
+
+			err := p.Stop(context.Background(), instanceName, true)
+			assert.Equal(t, tc.wantErr, err != nil)
+
+			if !tc.wantErr {
+				_, err = client.CoreV1().Pods(cfg.RunnerNamespace).Get(context.Background(), providerID, metav1.GetOptions{})
+				assert.True(t, apierrors.IsNotFound(err))
+
+				parked, err := client.CoreV1().ConfigMaps(cfg.RunnerNamespace).Get(context.Background(), providerID, metav1.GetOptions{})
+				assert.NoError(t, err)
+				assert.Equal(t, "true", parked.Labels[spec.GarmStoppedLabel])
+
+				parkedPod, err := spec.ParkedConfigMapToPod(parked)
+				assert.NoError(t, err)
+				assert.Empty(t, parkedPod.Spec.NodeName)
+
+				// the runner secret has to survive the deletion of the pod
+				runnerSecret, err := client.CoreV1().Secrets(cfg.RunnerNamespace).Get(context.Background(), spec.RunnerSecretName(providerID), metav1.GetOptions{})
+				if err == nil {
+					assert.Equal(t, "ConfigMap", runnerSecret.OwnerReferences[0].Kind)
+				}
+
+				actual, err := p.GetInstance(context.Background(), instanceName)
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedProviderInstance, actual)
+
+				instances, err := p.ListInstances(context.Background(), poolID)
+				assert.NoError(t, err)
+				assert.Equal(t, []params.ProviderInstance{tc.expectedProviderInstance}, instances)
+			}
+		})
+	}
+}
+
+func TestStartInstance(t *testing.T) {
+	runnerPod := &corev1.Pod{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Pod",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      providerID,
+			Namespace: "runner",
+			Labels: map[string]string{
+				spec.GarmInstanceNameLabel: instanceName,
+				spec.GarmPoolIDLabel:       poolID,
+				spec.GarmControllerIDLabel: controllerID,
+			},
+			Annotations: map[string]string{
+				spec.GarmPodSpecAnnotation: `{"containers":[{"name":"runner","image":"localhost:5000/runner:ubuntu-22.04","resources":{}}],"restartPolicy":"Never"}`,
+			},
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy: corev1.RestartPolicyNever,
+			Containers: []corev1.Container{
+				{
+					Name:  "runner",
+					Image: "localhost:5000/runner:ubuntu-22.04",
+				},
+			},
+		},
+	}
+	parkedConfigMap, err := spec.PodToParkedConfigMap(runnerPod)
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		name           string
+		config         *config.ProviderConfig
+		runtimeObjects []runtime.Object
+		expectedPod    *corev1.Pod
+		wantErr        bool
+	}{
+		{
+			name: "Start stopped instance",
+			config: &config.ProviderConfig{
+				RunnerNamespace: "runner",
+			},
+			runtimeObjects: []runtime.Object{parkedConfigMap.DeepCopy()},
+			expectedPod:    runnerPod,
+		},
+		{
+			name: "Start running instance",
+			config: &config.ProviderConfig{
+				RunnerNamespace: "runner",
+			},
+			runtimeObjects: []runtime.Object{runnerPod.DeepCopy()},
+			expectedPod:    runnerPod,
+		},
+		{
+			name: "Start unknown instance",
+			config: &config.ProviderConfig{
+				RunnerNamespace: "runner",
+			},
+			runtimeObjects: []runtime.Object{},
+			wantErr:        true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := tc.config
+
+			client := fake.NewSimpleClientset(tc.runtimeObjects...)
+
+			p, _ := provider.NewKubernetesProvider(cfg, client, controllerID, poolID)
+
+			err := p.Start(context.Background(), instanceName)
+			assert.Equal(t, tc.wantErr, err != nil)
+
+			if !tc.wantErr {
+				startedPod, err := client.CoreV1().Pods(cfg.RunnerNamespace).Get(context.Background(), providerID, metav1.GetOptions{})
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedPod, startedPod)
+
+				_, err = client.CoreV1().ConfigMaps(cfg.RunnerNamespace).Get(context.Background(), providerID, metav1.GetOptions{})
+				assert.True(t, apierrors.IsNotFound(err))
+			}
+		})
+	}
+}
+
 func toPointer(str string) *string {
 	return &str
 }
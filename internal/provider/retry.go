@@ -0,0 +1,79 @@
+// SPDX-License-Identifier: MIT
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// apiRetryBackoff bounds the retries of API calls failing with a transient error.
+// Many provider processes run in parallel during large scale-ups, the jitter spreads their retries.
+var apiRetryBackoff = wait.Backoff{
+	Steps:    5,
+	Duration: 100 * time.Millisecond,
+	Factor:   2.0,
+	Jitter:   0.5,
+	Cap:      2 * time.Second,
+}
+
+// isRetriable reports if an API call failed with an error which is worth retrying,
+// like throttling, internal server errors, an unavailable API server or timeouts
+func isRetriable(err error) bool {
+	if apierrors.IsTooManyRequests(err) ||
+		apierrors.IsInternalError(err) ||
+		apierrors.IsServiceUnavailable(err) ||
+		apierrors.IsServerTimeout(err) ||
+		apierrors.IsTimeout(err) {
+		return true
+	}
+
+	if utilnet.IsConnectionReset(err) || utilnet.IsConnectionRefused(err) || utilnet.IsProbableEOF(err) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// withRetry calls fn until it succeeds, fails with an error which is not retriable,
+// the retries are exhausted or ctx is done. The last error of fn is returned.
+func withRetry[T any](ctx context.Context, fn func() (T, error)) (T, error) {
+	var result T
+	var lastErr error
+	err := wait.ExponentialBackoffWithContext(ctx, apiRetryBackoff, func(context.Context) (bool, error) {
+		var err error
+		result, err = fn()
+		switch {
+		case err == nil:
+			return true, nil
+		case isRetriable(err):
+			lastErr = err
+			return false, nil
+		default:
+			return false, err
+		}
+	})
+	if wait.Interrupted(err) {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			err = errors.Join(ctxErr, lastErr)
+		} else if lastErr != nil {
+			err = lastErr
+		}
+	}
+	return result, err
+}
+
+// retryOnError is withRetry for API calls which only return an error
+func retryOnError(ctx context.Context, fn func() error) error {
+	_, err := withRetry(ctx, func() (struct{}, error) {
+		return struct{}{}, fn()
+	})
+	return err
+}
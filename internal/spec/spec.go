@@ -3,23 +3,54 @@
 package spec
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"maps"
+	"math"
 	"net/url"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
 	"strings"
-	"unicode"
+	"time"
 
 	"github.com/cloudbase/garm-provider-common/params"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/utils/ptr"
 
 	"github.com/mercedes-benz/garm-provider-k8s/pkg/config"
+	"github.com/mercedes-benz/garm-provider-k8s/runner"
 )
 
 var (
 	runnerVolumeName      = "runner"
 	runnerVolumeMountPath = "/runner"
 	runnerVolumeEmptyDir  = &corev1.EmptyDirVolumeSource{}
+	parkedPodKey          = "pod.json"
+	runnerSecretTokenKey  = "BEARER_TOKEN"
+	caBundleVolumeName    = "garm-ca-bundle"
+	caBundleMountPath     = "/etc/garm/ca"
+	caBundleKey           = "ca-bundle.crt"
+	entrypointVolumeName  = "garm-entrypoint"
+	entrypointMountPath   = "/etc/garm/entrypoint"
+	entrypointKey         = "entrypoint.sh"
+	caBundleScriptKey     = "ca-bundle.sh"
+	toolsInstallerName    = "install-runner"
+	toolsDownloadTokenKey = "TOOLS_DOWNLOAD_TOKEN"
+
+	// maxLabelValueLength is the maximum length of a label value
+	maxLabelValueLength = 63
+	// maxPodNameLength keeps pod names valid DNS labels, as they are used as hostname and label value
+	maxPodNameLength = 63
+	// nameHashLength is the length of the hash suffix of sanitized names
+	nameHashLength = 8
+
+	// maxProviderFaultEvents limits the amount of events added to the provider fault of an instance
+	maxProviderFaultEvents = 3
 )
 
 const (
@@ -32,6 +63,17 @@ const (
 	GarmOSVersionLabel    = "garm/os_version"
 	GarmRunnerGroupLabel  = "garm/runner-group"
 	GarmPoolIDLabel       = "garm/poolID"
+	GarmStoppedLabel      = "garm/stopped"
+	GarmPodNameLabel      = "garm/pod-name"
+
+	GarmPodSpecAnnotation = "garm/pod-spec"
+
+	// annotations hold the original values of labels, which might have been sanitized or truncated
+	GarmInstanceNameAnnotation = "garm/instance-name"
+	GarmFlavorAnnotation       = "garm/flavor"
+	GarmOSNameAnnotation       = "garm/os_name"
+	GarmOSVersionAnnotation    = "garm/os_version"
+	GarmRunnerGroupAnnotation  = "garm/runner-group"
 )
 
 type GitHubScopeDetails struct {
@@ -51,6 +93,16 @@ type (
 type ExtraSpecs struct {
 	OSName    OSName
 	OSVersion OSVersion
+	// PodTemplate is a pool specific pod template fragment
+	// which gets merged on top of the global pod template
+	PodTemplate corev1.PodTemplateSpec `json:"podTemplate"`
+	// PodTemplateName references an entry of the podTemplates
+	// in the provider config
+	PodTemplateName string `json:"podTemplateName"`
+	// RunnerInstallMode overrides the runnerInstallMode of the provider config
+	RunnerInstallMode string `json:"runnerInstallMode"`
+	// Cluster routes the pool to one of the clusters in the provider config
+	Cluster string `json:"cluster"`
 }
 
 type ImageDetails struct {
@@ -60,6 +112,45 @@ type ImageDetails struct {
 	OSVersion OSVersion
 }
 
+// containerFailureReasons are reasons of waiting containers
+// which indicate that a pod will not come up without intervention
+var containerFailureReasons = map[string]bool{
+	"ErrImagePull":               true,
+	"ImagePullBackOff":           true,
+	"ErrImageNeverPull":          true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+	"CreateContainerError":       true,
+	"RunContainerError":          true,
+	"CrashLoopBackOff":           true,
+}
+
+// githubArchs maps the garm OS architectures to the ones used by the runner tools of GitHub
+var githubArchs = map[params.OSArch]string{
+	params.Amd64: "x64",
+	params.Arm:   "arm",
+	params.Arm64: "arm64",
+}
+
+// toolsInstallScript downloads the runner from the garm tools into the runner volume.
+// The CA bundle passed by garm is trusted in addition to the CA certificates of the system.
+var toolsInstallScript = `set -e
+if [ -n "$GARM_CA_BUNDLE_FILE" ]; then
+  cat /etc/ssl/certs/ca-certificates.crt "$GARM_CA_BUNDLE_FILE" > /tmp/ca-bundle.crt
+  export CURL_CA_BUNDLE=/tmp/ca-bundle.crt
+fi
+if [ -n "$TOOLS_DOWNLOAD_TOKEN" ]; then
+  curl --retry 5 --retry-delay 5 --fail -sSL -H "Authorization: Bearer $TOOLS_DOWNLOAD_TOKEN" -o "/tmp/$TOOLS_FILENAME" "$TOOLS_DOWNLOAD_URL"
+else
+  curl --retry 5 --retry-delay 5 --fail -sSL -o "/tmp/$TOOLS_FILENAME" "$TOOLS_DOWNLOAD_URL"
+fi
+if [ -n "$TOOLS_SHA256_CHECKSUM" ]; then
+  echo "$TOOLS_SHA256_CHECKSUM  /tmp/$TOOLS_FILENAME" | sha256sum -c -
+fi
+tar -xzf "/tmp/$TOOLS_FILENAME" -C ` + runnerVolumeMountPath + `
+rm -f "/tmp/$TOOLS_FILENAME"
+`
+
 var statusMap = map[string]string{
 	"Running":   "running",
 	"Succeeded": "stopped",
@@ -69,19 +160,24 @@ var statusMap = map[string]string{
 }
 
 func PodToInstance(pod *corev1.Pod, overwriteInstanceStatus params.InstanceStatus) (*params.ProviderInstance, error) {
-	instanceName, ok := pod.ObjectMeta.Labels[GarmInstanceNameLabel]
+	instanceName, ok := pod.ObjectMeta.Annotations[GarmInstanceNameAnnotation]
+	if !ok {
+		instanceName, ok = pod.ObjectMeta.Labels[GarmInstanceNameLabel]
+	}
 	if !ok {
 		instanceName = pod.Name
 	}
 
-	// for garm to work properly, during creation of instance status needs to be set manually to "running", other than the status is derived from pod.Status.Phase
+	instanceStatus, providerFault := PodToInstanceStatus(pod)
+
+	// for garm to work properly, during creation of instance status needs to be set manually to "running", other than the status is derived from the pod
 	if overwriteInstanceStatus == "" {
-		overwriteInstanceStatus = params.InstanceStatus(statusMap[string(pod.Status.Phase)])
+		overwriteInstanceStatus = instanceStatus
 	}
 
 	imageDetails := ExtractImageDetails(pod)
 
-	return &params.ProviderInstance{
+	instance := &params.ProviderInstance{
 		ProviderID: pod.Name,
 		Name:       instanceName,
 		Status:     overwriteInstanceStatus,
@@ -89,7 +185,46 @@ func PodToInstance(pod *corev1.Pod, overwriteInstanceStatus params.InstanceStatu
 		OSType:     params.OSType(imageDetails.OSType),
 		OSName:     string(imageDetails.OSName),
 		OSVersion:  string(imageDetails.OSVersion),
-	}, nil
+	}
+
+	if providerFault != "" {
+		instance.ProviderFault = []byte(providerFault)
+	}
+
+	return instance, nil
+}
+
+// PodToInstanceStatus derives the garm instance status from the pod phase,
+// the pod conditions and the container states.
+// The returned fault describes why a pod is not healthy.
+func PodToInstanceStatus(pod *corev1.Pod) (params.InstanceStatus, string) {
+	instanceStatus := params.InstanceStatus(statusMap[string(pod.Status.Phase)])
+
+	switch pod.Status.Phase {
+	case corev1.PodFailed, corev1.PodUnknown:
+		// e.g. evicted pods or pods on lost nodes
+		return instanceStatus, joinReason(pod.Status.Reason, pod.Status.Message)
+	case corev1.PodSucceeded:
+		return instanceStatus, ""
+	}
+
+	if failure := containerFailure(pod); failure != "" {
+		return params.InstanceError, failure
+	}
+
+	// the runner container might be gone (e.g. OOMKilled) while sidecars keep the pod running
+	if termination := containerTermination(pod); termination != "" {
+		return params.InstanceError, termination
+	}
+
+	// unschedulable pods stay pending, as they might get scheduled after the cluster got scaled up
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodScheduled && condition.Status == corev1.ConditionFalse {
+			return instanceStatus, joinReason(condition.Reason, condition.Message)
+		}
+	}
+
+	return instanceStatus, ""
 }
 
 func ParamsToPodLabels(controllerID string, bootstrapParams params.BootstrapInstance) map[string]string {
@@ -98,8 +233,8 @@ func ParamsToPodLabels(controllerID string, bootstrapParams params.BootstrapInst
 
 	err := json.Unmarshal(bootstrapParams.ExtraSpecs, &extraSpecs)
 	if err == nil {
-		labels[GarmOSNameLabel] = string(extraSpecs.OSName)
-		labels[GarmOSVersionLabel] = string(extraSpecs.OSVersion)
+		labels[GarmOSNameLabel] = ToValidLabel(string(extraSpecs.OSName))
+		labels[GarmOSVersionLabel] = ToValidLabel(string(extraSpecs.OSVersion))
 	}
 
 	labels[GarmInstanceNameLabel] = ToValidLabel(bootstrapParams.Name)
@@ -113,12 +248,136 @@ func ParamsToPodLabels(controllerID string, bootstrapParams params.BootstrapInst
 	return labels
 }
 
-func FlavorToResourceRequirements(flavor string) corev1.ResourceRequirements {
-	if _, ok := config.Config.Flavors[flavor]; !ok {
-		return corev1.ResourceRequirements{}
+// SameInstance reports if the given pod belongs to the instance with the given labels,
+// which means it was created by the same controller for the same pool and instance name
+func SameInstance(pod *corev1.Pod, labels map[string]string) bool {
+	for _, label := range []string{GarmInstanceNameLabel, GarmControllerIDLabel, GarmPoolIDLabel} {
+		if pod.Labels[label] != labels[label] {
+			return false
+		}
+	}
+	return true
+}
+
+// ParamsToPodAnnotations returns the annotations holding the original values
+// of all labels which are not restricted to valid label values by garm
+func ParamsToPodAnnotations(bootstrapParams params.BootstrapInstance) map[string]string {
+	annotations := map[string]string{
+		GarmInstanceNameAnnotation: bootstrapParams.Name,
+		GarmFlavorAnnotation:       bootstrapParams.Flavor,
+		GarmRunnerGroupAnnotation:  bootstrapParams.GitHubRunnerGroup,
+	}
+
+	extraSpecs := ExtraSpecs{}
+	err := json.Unmarshal(bootstrapParams.ExtraSpecs, &extraSpecs)
+	if err == nil {
+		annotations[GarmOSNameAnnotation] = string(extraSpecs.OSName)
+		annotations[GarmOSVersionAnnotation] = string(extraSpecs.OSVersion)
+	}
+
+	return annotations
+}
+
+// ParseExtraSpecs decodes the extra_specs of a pool.
+// Empty extra_specs result in empty ExtraSpecs.
+func ParseExtraSpecs(rawExtraSpecs []byte) (ExtraSpecs, error) {
+	extraSpecs := ExtraSpecs{}
+	if len(rawExtraSpecs) == 0 {
+		return extraSpecs, nil
+	}
+
+	if err := json.Unmarshal(rawExtraSpecs, &extraSpecs); err != nil {
+		return ExtraSpecs{}, fmt.Errorf("failed to unmarshal extra_specs: %w", err)
+	}
+	return extraSpecs, nil
+}
+
+// NamedPodTemplate returns the pod template from the configured podTemplates
+// which is referenced by the extra_specs of a pool.
+// Without a reference, a pod template named like the flavor of the pool is used.
+func NamedPodTemplate(cfg *config.ProviderConfig, flavor string, extraSpecs ExtraSpecs) (corev1.PodTemplateSpec, error) {
+	if extraSpecs.PodTemplateName == "" {
+		return cfg.PodTemplates[flavor], nil
+	}
+
+	podTemplate, ok := cfg.PodTemplates[extraSpecs.PodTemplateName]
+	if !ok {
+		return corev1.PodTemplateSpec{}, fmt.Errorf("pod template %s is not configured", extraSpecs.PodTemplateName)
+	}
+	return podTemplate, nil
+}
+
+// RunnerInstallMode returns how the runner gets into the runner container of a pool.
+// The runnerInstallMode of the extra_specs takes precedence over the provider config.
+func RunnerInstallMode(cfg *config.ProviderConfig, extraSpecs ExtraSpecs) (string, error) {
+	if extraSpecs.RunnerInstallMode == "" {
+		return cfg.RunnerInstallMode, nil
+	}
+
+	if err := config.ValidateRunnerInstallMode(extraSpecs.RunnerInstallMode); err != nil {
+		return "", err
+	}
+	return extraSpecs.RunnerInstallMode, nil
+}
+
+// ResolveFlavor returns the flavor a pool is created with.
+// An unknown flavor is handled according to the unknownFlavorPolicy of the provider config.
+func ResolveFlavor(cfg *config.ProviderConfig, flavor string) (string, error) {
+	if cfg.KnownFlavor(flavor) {
+		return flavor, nil
+	}
+
+	switch cfg.UnknownFlavorPolicy {
+	case config.UnknownFlavorPolicyReject:
+		return "", fmt.Errorf("flavor %q is not configured", flavor)
+	case config.UnknownFlavorPolicyDefaultFlavor:
+		return cfg.DefaultFlavor, nil
+	default:
+		return flavor, nil
+	}
+}
+
+// FlavorPodTemplate returns the pod template of a flavor. It sets the resource requirements of the runner
+// container and the scheduling constraints of the flavor on top of the pod template fragment of the flavor.
+// A flavor which is not configured in flavors results in an empty pod template.
+func FlavorPodTemplate(cfg *config.ProviderConfig, flavor, runnerContainerName string) corev1.PodTemplateSpec {
+	flavorConfig, ok := cfg.Flavors[flavor]
+	if !ok {
+		return corev1.PodTemplateSpec{}
+	}
+
+	podTemplate := *flavorConfig.PodTemplate.DeepCopy()
+	podSpec := &podTemplate.Spec
+
+	if !reflect.ValueOf(flavorConfig.ResourceRequirements).IsZero() {
+		runnerContainer := slices.IndexFunc(podSpec.Containers, func(container corev1.Container) bool {
+			return container.Name == runnerContainerName
+		})
+		if runnerContainer < 0 {
+			podSpec.Containers = append(podSpec.Containers, corev1.Container{Name: runnerContainerName})
+			runnerContainer = len(podSpec.Containers) - 1
+		}
+		podSpec.Containers[runnerContainer].Resources = *flavorConfig.ResourceRequirements.DeepCopy()
+	}
+
+	if len(flavorConfig.NodeSelector) > 0 {
+		if podSpec.NodeSelector == nil {
+			podSpec.NodeSelector = map[string]string{}
+		}
+		maps.Copy(podSpec.NodeSelector, flavorConfig.NodeSelector)
+	}
+	podSpec.Tolerations = append(podSpec.Tolerations, flavorConfig.Tolerations...)
+	if flavorConfig.Affinity != nil {
+		podSpec.Affinity = flavorConfig.Affinity.DeepCopy()
+	}
+	if flavorConfig.PriorityClassName != "" {
+		podSpec.PriorityClassName = flavorConfig.PriorityClassName
+	}
+	if flavorConfig.RuntimeClassName != nil {
+		podSpec.RuntimeClassName = ptr.To(*flavorConfig.RuntimeClassName)
 	}
 
-	return config.Config.Flavors[flavor]
+	return podTemplate
 }
 
 func ExtractGitHubScopeDetails(gitRepoURL string) (GitHubScopeDetails, error) {
@@ -156,9 +415,17 @@ func ExtractGitHubScopeDetails(gitRepoURL string) (GitHubScopeDetails, error) {
 }
 
 func isValidLabelChar(r rune) bool {
-	return unicode.IsLetter(r) || unicode.IsNumber(r) || r == '-' || r == '_' || r == '.'
+	return isAlphanumeric(r) || r == '-' || r == '_' || r == '.'
 }
 
+func isAlphanumeric(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+}
+
+// ToValidLabel converts the input into a valid label value.
+// Invalid characters are replaced and values exceeding the maximum length
+// are truncated, a hash of the input keeps truncated values unique.
+// The original value has to be kept in an annotation if it's needed again.
 func ToValidLabel(input string) string {
 	var sb strings.Builder
 
@@ -174,28 +441,37 @@ func ToValidLabel(input string) string {
 
 	// Ensure the resulting string starts and ends with an alphanumeric character
 	if len(result) > 0 {
-		if !unicode.IsLetter(rune(result[0])) && !unicode.IsNumber(rune(result[0])) {
+		if !isAlphanumeric(rune(result[0])) {
 			result = "a" + result[1:]
 		}
 
 		lastIndex := len(result) - 1
-		if !unicode.IsLetter(rune(result[lastIndex])) && !unicode.IsNumber(rune(result[lastIndex])) {
+		if !isAlphanumeric(rune(result[lastIndex])) {
 			result = result[:lastIndex] + "0"
 		}
 	}
 
+	if len(result) > maxLabelValueLength {
+		hash := sha256.Sum256([]byte(input))
+		suffix := hex.EncodeToString(hash[:])[:nameHashLength]
+		result = result[:maxLabelValueLength-len(suffix)-1] + "-" + suffix
+	}
+
 	return result
 }
 
-func CreateRunnerVolume(pod *corev1.Pod) error {
+func CreateRunnerVolume(cfg *config.ProviderConfig, pod *corev1.Pod, podTemplates ...corev1.PodTemplateSpec) error {
 	if len(pod.Spec.Containers) < 1 {
 		return fmt.Errorf("pod %s has no runner container spec", pod.Name)
 	}
 
 	// Skip volume creation if a volume with the default name already exists in podTemplate
-	for _, vol := range config.Config.PodTemplate.Spec.Volumes {
-		if vol.Name == runnerVolumeName {
-			return nil
+	// or in any of the additional pod templates which get merged into the pod
+	for _, podTemplate := range append([]corev1.PodTemplateSpec{cfg.PodTemplate}, podTemplates...) {
+		for _, vol := range podTemplate.Spec.Volumes {
+			if vol.Name == runnerVolumeName {
+				return nil
+			}
 		}
 	}
 
@@ -211,20 +487,22 @@ func CreateRunnerVolume(pod *corev1.Pod) error {
 	return nil
 }
 
-func CreateRunnerVolumeMount(pod *corev1.Pod, runnerContainerName string) error {
+func CreateRunnerVolumeMount(cfg *config.ProviderConfig, pod *corev1.Pod, runnerContainerName string, podTemplates ...corev1.PodTemplateSpec) error {
 	if len(pod.Spec.Containers) < 1 {
 		return fmt.Errorf("pod %s has no runner container spec", pod.Name)
 	}
 
 	// Skip volumemount creation if a volumemount with the same path already exists
-	// in podTemplate for the default container
-	for _, container := range config.Config.PodTemplate.Spec.Containers {
-		if container.Name == runnerContainerName {
-			for _, volMounts := range container.VolumeMounts {
-				// Volumemount paths e.g. /runner and /runner/ are threated equal
-				// The last one in the pod spec will take precedence, which can lead to unexpected behavior
-				if filepath.Clean(volMounts.MountPath) == runnerVolumeMountPath {
-					return nil
+	// in podTemplate or any additional pod template for the default container
+	for _, podTemplate := range append([]corev1.PodTemplateSpec{cfg.PodTemplate}, podTemplates...) {
+		for _, container := range podTemplate.Spec.Containers {
+			if container.Name == runnerContainerName {
+				for _, volMounts := range container.VolumeMounts {
+					// Volumemount paths e.g. /runner and /runner/ are threated equal
+					// The last one in the pod spec will take precedence, which can lead to unexpected behavior
+					if filepath.Clean(volMounts.MountPath) == runnerVolumeMountPath {
+						return nil
+					}
 				}
 			}
 		}
@@ -241,7 +519,198 @@ func CreateRunnerVolumeMount(pod *corev1.Pod, runnerContainerName string) error
 	return nil
 }
 
-func GetRunnerEnvs(gitHubScope GitHubScopeDetails, bootstrapParams params.BootstrapInstance) []corev1.EnvVar {
+// AddCABundle mounts the CA bundle of the instance into the runner container.
+// SSL_CERT_FILE is not set, as it would replace the system CAs. The entrypoint
+// of the runner image combines both and exports SSL_CERT_FILE instead.
+// The bundle itself is stored in the configmap created by NewCABundleConfigMap.
+func AddCABundle(pod *corev1.Pod, runnerContainerName string) error {
+	var runnerContainer *corev1.Container
+	for i := range pod.Spec.Containers {
+		if pod.Spec.Containers[i].Name == runnerContainerName {
+			runnerContainer = &pod.Spec.Containers[i]
+		}
+	}
+	if runnerContainer == nil {
+		return fmt.Errorf("pod %s has no runner container spec", pod.Name)
+	}
+
+	pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+		Name: caBundleVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			Projected: &corev1.ProjectedVolumeSource{
+				Sources: []corev1.VolumeProjection{
+					{
+						ConfigMap: &corev1.ConfigMapProjection{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: CABundleConfigMapName(pod.Name),
+							},
+							Items: []corev1.KeyToPath{
+								{
+									Key:  caBundleKey,
+									Path: caBundleKey,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	})
+
+	runnerContainer.VolumeMounts = append(runnerContainer.VolumeMounts, corev1.VolumeMount{
+		Name:      caBundleVolumeName,
+		MountPath: caBundleMountPath,
+		ReadOnly:  true,
+	})
+
+	caBundleFile := filepath.Join(caBundleMountPath, caBundleKey)
+	runnerContainer.Env = append(runnerContainer.Env,
+		corev1.EnvVar{
+			Name:  "GARM_CA_BUNDLE_FILE",
+			Value: caBundleFile,
+		},
+		corev1.EnvVar{
+			Name:  "NODE_EXTRA_CA_CERTS",
+			Value: caBundleFile,
+		},
+	)
+
+	return nil
+}
+
+// RunnerTool returns the runner tool matching the OS type and architecture of an instance
+func RunnerTool(osType params.OSType, osArch params.OSArch, tools []params.RunnerApplicationDownload) (params.RunnerApplicationDownload, error) {
+	githubArch, ok := githubArchs[osArch]
+	if !ok {
+		return params.RunnerApplicationDownload{}, fmt.Errorf("unsupported OS arch: %s", osArch)
+	}
+
+	githubOS := string(osType)
+	if osType == params.Windows {
+		githubOS = "win"
+	}
+
+	for _, tool := range tools {
+		if tool.GetOS() == githubOS && tool.GetArchitecture() == githubArch {
+			return tool, nil
+		}
+	}
+	return params.RunnerApplicationDownload{}, fmt.Errorf("failed to find tools for OS %s and arch %s", osType, osArch)
+}
+
+// AddRunnerTools installs the runner from the given garm tools into the runner volume
+// by an init container and starts it with the entrypoint of the upstream runner image,
+// so stock base images can be used as runner image.
+// The entrypoint itself is stored in the configmap created by NewEntrypointConfigMap.
+func AddRunnerTools(cfg *config.ProviderConfig, pod *corev1.Pod, runnerContainerName string, tool params.RunnerApplicationDownload, runnerSecretName string) error {
+	var runnerContainer *corev1.Container
+	for i := range pod.Spec.Containers {
+		if pod.Spec.Containers[i].Name == runnerContainerName {
+			runnerContainer = &pod.Spec.Containers[i]
+		}
+	}
+	if runnerContainer == nil {
+		return fmt.Errorf("pod %s has no runner container spec", pod.Name)
+	}
+
+	if tool.GetOS() != "linux" {
+		return fmt.Errorf("runner tools for %s are not supported, only linux runners can be installed from tools", tool.GetOS())
+	}
+	if tool.GetDownloadURL() == "" || tool.GetFilename() == "" {
+		return fmt.Errorf("runner tools for %s/%s have no download url", tool.GetOS(), tool.GetArchitecture())
+	}
+
+	pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+		Name: entrypointVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: EntrypointConfigMapName(pod.Name),
+				},
+				DefaultMode: ptr.To[int32](0o755),
+			},
+		},
+	})
+
+	installer := corev1.Container{
+		Name:    toolsInstallerName,
+		Image:   cfg.ToolsInstallerImage,
+		Command: []string{"/bin/sh", "-c", toolsInstallScript},
+		Env: []corev1.EnvVar{
+			{
+				Name:  "TOOLS_DOWNLOAD_URL",
+				Value: tool.GetDownloadURL(),
+			},
+			{
+				Name:  "TOOLS_FILENAME",
+				Value: tool.GetFilename(),
+			},
+			{
+				Name:  "TOOLS_SHA256_CHECKSUM",
+				Value: tool.GetSHA256Checksum(),
+			},
+			{
+				Name: toolsDownloadTokenKey,
+				ValueFrom: &corev1.EnvVarSource{
+					SecretKeyRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: runnerSecretName,
+						},
+						Key:      toolsDownloadTokenKey,
+						Optional: ptr.To(true),
+					},
+				},
+			},
+		},
+		VolumeMounts: []corev1.VolumeMount{
+			{
+				Name:      runnerVolumeName,
+				MountPath: runnerVolumeMountPath,
+			},
+		},
+	}
+
+	// the runner might be downloaded from a GHES using an internal CA
+	for _, volumeMount := range runnerContainer.VolumeMounts {
+		if volumeMount.Name == caBundleVolumeName {
+			installer.VolumeMounts = append(installer.VolumeMounts, volumeMount)
+			installer.Env = append(installer.Env, corev1.EnvVar{
+				Name:  "GARM_CA_BUNDLE_FILE",
+				Value: filepath.Join(caBundleMountPath, caBundleKey),
+			})
+		}
+	}
+	pod.Spec.InitContainers = append(pod.Spec.InitContainers, installer)
+
+	runnerContainer.Command = []string{"/bin/bash", filepath.Join(entrypointMountPath, entrypointKey)}
+	runnerContainer.VolumeMounts = append(runnerContainer.VolumeMounts, corev1.VolumeMount{
+		Name:      entrypointVolumeName,
+		MountPath: entrypointMountPath,
+		ReadOnly:  true,
+	})
+	runnerContainer.Env = append(runnerContainer.Env,
+		corev1.EnvVar{
+			Name:  "RUNNER_ASSETS_DIR",
+			Value: runnerVolumeMountPath,
+		},
+		corev1.EnvVar{
+			Name:  "RUNNER_HOME",
+			Value: runnerVolumeMountPath,
+		},
+		corev1.EnvVar{
+			Name:  "RUNNER_ALLOW_RUNASROOT",
+			Value: "1",
+		},
+		corev1.EnvVar{
+			Name:  "RUNNER_INSTALL_DEPENDENCIES",
+			Value: "true",
+		},
+	)
+
+	return nil
+}
+
+func GetRunnerEnvs(gitHubScope GitHubScopeDetails, bootstrapParams params.BootstrapInstance, runnerSecretName string) []corev1.EnvVar {
 	return []corev1.EnvVar{
 		{
 			Name:  "RUNNER_ORG",
@@ -296,8 +765,15 @@ func GetRunnerEnvs(gitHubScope GitHubScopeDetails, bootstrapParams params.Bootst
 			Value: bootstrapParams.MetadataURL,
 		},
 		{
-			Name:  "BEARER_TOKEN",
-			Value: bootstrapParams.InstanceToken,
+			Name: runnerSecretTokenKey,
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: runnerSecretName,
+					},
+					Key: runnerSecretTokenKey,
+				},
+			},
 		},
 		{
 			Name:  "CALLBACK_URL",
@@ -310,11 +786,434 @@ func GetRunnerEnvs(gitHubScope GitHubScopeDetails, bootstrapParams params.Bootst
 	}
 }
 
+// PodName returns the name of the runner pod of an instance.
+// Instance names which are no valid DNS labels are sanitized and truncated,
+// a hash of the instance name keeps the result unique and deterministic.
+// Valid names, and therefore pod names, are returned unchanged.
+func PodName(instanceName string) string {
+	lower := strings.ToLower(instanceName)
+
+	var sb strings.Builder
+	for _, r := range lower {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' {
+			sb.WriteRune(r)
+		} else {
+			sb.WriteRune('-')
+		}
+	}
+	name := strings.Trim(sb.String(), "-")
+	if name != "" && name == lower && len(name) <= maxPodNameLength {
+		return name
+	}
+
+	hash := sha256.Sum256([]byte(instanceName))
+	suffix := hex.EncodeToString(hash[:])[:nameHashLength]
+
+	maxPrefixLength := maxPodNameLength - len(suffix) - 1
+	if len(name) > maxPrefixLength {
+		name = strings.TrimRight(name[:maxPrefixLength], "-")
+	}
+	if name == "" {
+		return suffix
+	}
+	return name + "-" + suffix
+}
+
+// RunnerSecretName returns the name of the secret
+// which holds the credentials of the runner pod
+func RunnerSecretName(podName string) string {
+	return podName + "-credentials"
+}
+
+// NewRunnerSecret creates the secret for the credentials of the runner,
+// so they don't show up as plain values in the pod spec
+func NewRunnerSecret(pod *corev1.Pod, bootstrapParams params.BootstrapInstance) *corev1.Secret {
+	return &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Secret",
+		},
+		ObjectMeta: AuxiliaryObjectMeta(pod, RunnerSecretName(pod.Name)),
+		Type:       corev1.SecretTypeOpaque,
+		Data: map[string][]byte{
+			runnerSecretTokenKey: []byte(bootstrapParams.InstanceToken),
+		},
+	}
+}
+
+// CABundleConfigMapName returns the name of the configmap
+// which holds the CA bundle of the runner pod
+func CABundleConfigMapName(podName string) string {
+	return podName + "-ca-bundle"
+}
+
+// NewCABundleConfigMap creates the configmap for the CA bundle passed by garm,
+// which is needed to talk to a GHES or garm instance using an internal CA
+func NewCABundleConfigMap(pod *corev1.Pod, caCertBundle []byte) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "ConfigMap",
+		},
+		ObjectMeta: AuxiliaryObjectMeta(pod, CABundleConfigMapName(pod.Name)),
+		Data: map[string]string{
+			caBundleKey: string(caCertBundle),
+		},
+	}
+}
+
+// AddToolsDownloadToken adds the token needed to download the given garm tools
+// to the runner secret
+func AddToolsDownloadToken(secret *corev1.Secret, tool params.RunnerApplicationDownload) {
+	if tool.GetTempDownloadToken() == "" {
+		return
+	}
+	secret.Data[toolsDownloadTokenKey] = []byte(tool.GetTempDownloadToken())
+}
+
+// EntrypointConfigMapName returns the name of the configmap
+// which holds the entrypoint of a runner installed from the garm tools
+func EntrypointConfigMapName(podName string) string {
+	return podName + "-entrypoint"
+}
+
+// NewEntrypointConfigMap creates the configmap for the entrypoint
+// of a runner installed from the garm tools
+func NewEntrypointConfigMap(pod *corev1.Pod) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "ConfigMap",
+		},
+		ObjectMeta: AuxiliaryObjectMeta(pod, EntrypointConfigMapName(pod.Name)),
+		Data: map[string]string{
+			entrypointKey:     runner.UpstreamEntrypoint,
+			caBundleScriptKey: runner.CABundleScript,
+		},
+	}
+}
+
+// AddDeregistrationHook adds a preStop hook to the runner container, which deregisters
+// the runner before the container gets stopped. The termination grace period of the pod
+// is raised to the given timeout, as the kubelet kills the container afterwards.
+func AddDeregistrationHook(pod *corev1.Pod, runnerContainerName string, command []string, timeout time.Duration) error {
+	var runnerContainer *corev1.Container
+	for i := range pod.Spec.Containers {
+		if pod.Spec.Containers[i].Name == runnerContainerName {
+			runnerContainer = &pod.Spec.Containers[i]
+		}
+	}
+	if runnerContainer == nil {
+		return fmt.Errorf("pod %s has no runner container spec", pod.Name)
+	}
+
+	if runnerContainer.Lifecycle == nil {
+		runnerContainer.Lifecycle = &corev1.Lifecycle{}
+	}
+	runnerContainer.Lifecycle.PreStop = &corev1.LifecycleHandler{
+		Exec: &corev1.ExecAction{
+			Command: command,
+		},
+	}
+
+	// the grace period is only ever raised, an unset one defaults to 30s
+	currentGracePeriodSeconds := int64(corev1.DefaultTerminationGracePeriodSeconds)
+	if pod.Spec.TerminationGracePeriodSeconds != nil {
+		currentGracePeriodSeconds = *pod.Spec.TerminationGracePeriodSeconds
+	}
+	if gracePeriodSeconds := DeregistrationGracePeriodSeconds(timeout); gracePeriodSeconds > currentGracePeriodSeconds {
+		pod.Spec.TerminationGracePeriodSeconds = ptr.To(gracePeriodSeconds)
+	}
+	return nil
+}
+
+// DeregistrationGracePeriodSeconds returns the grace period a runner pod needs
+// to run its deregistration command within the given timeout
+func DeregistrationGracePeriodSeconds(timeout time.Duration) int64 {
+	return int64(math.Ceil(timeout.Seconds()))
+}
+
+// AuxiliaryObjectMeta returns the metadata of an object which belongs to the given runner pod.
+// It carries the garm labels of the pod, so it can be found and cleaned up together with the pod.
+func AuxiliaryObjectMeta(pod *corev1.Pod, name string) metav1.ObjectMeta {
+	auxiliaryLabels := make(map[string]string, len(pod.Labels)+1)
+	for key, value := range pod.Labels {
+		auxiliaryLabels[key] = value
+	}
+	auxiliaryLabels[GarmPodNameLabel] = pod.Name
+
+	return metav1.ObjectMeta{
+		Name:      name,
+		Namespace: pod.Namespace,
+		Labels:    auxiliaryLabels,
+	}
+}
+
+// OwnerReference returns a controller reference to the given object,
+// so dependent objects get garbage collected together with their owner
+func OwnerReference(owner metav1.Object, kind string) metav1.OwnerReference {
+	return metav1.OwnerReference{
+		APIVersion: "v1",
+		Kind:       kind,
+		Name:       owner.GetName(),
+		UID:        owner.GetUID(),
+		Controller: ptr.To(true),
+	}
+}
+
+// ExtractImageDetails returns the OS details of a runner pod.
+// The original values in the annotations take precedence over the labels.
 func ExtractImageDetails(pod *corev1.Pod) *ImageDetails {
 	return &ImageDetails{
 		OSType:    OSType(pod.Labels[GarmOSTypeLabel]),
-		OSName:    OSName(pod.Labels[GarmOSNameLabel]),
-		OSVersion: OSVersion(pod.Labels[GarmOSVersionLabel]),
+		OSName:    OSName(annotationOrLabel(pod, GarmOSNameAnnotation, GarmOSNameLabel)),
+		OSVersion: OSVersion(annotationOrLabel(pod, GarmOSVersionAnnotation, GarmOSVersionLabel)),
 		OSArch:    OSArch(pod.Labels[GarmOSArchLabel]),
 	}
 }
+
+func annotationOrLabel(pod *corev1.Pod, annotation, label string) string {
+	if value, ok := pod.Annotations[annotation]; ok {
+		return value
+	}
+	return pod.Labels[label]
+}
+
+// PersistPodSpec stores the final pod spec as annotation on the pod,
+// so the pod can be recreated from it after it has been stopped.
+func PersistPodSpec(pod *corev1.Pod) error {
+	podSpec, err := json.Marshal(pod.Spec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal spec of pod %s: %w", pod.Name, err)
+	}
+
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	pod.Annotations[GarmPodSpecAnnotation] = string(podSpec)
+
+	return nil
+}
+
+// PodToParkedConfigMap converts a runner pod into a ConfigMap which holds
+// everything needed to recreate the pod on Start.
+// The pod spec is taken from the annotation persisted at creation time.
+// Pods without this annotation fall back to their current spec.
+func PodToParkedConfigMap(pod *corev1.Pod) (*corev1.ConfigMap, error) {
+	podSpec := pod.Spec.DeepCopy()
+	if persisted, ok := pod.Annotations[GarmPodSpecAnnotation]; ok {
+		podSpec = &corev1.PodSpec{}
+		if err := json.Unmarshal([]byte(persisted), podSpec); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal persisted spec of pod %s: %w", pod.Name, err)
+		}
+	}
+	// the scheduler has to decide again where the pod will be started
+	podSpec.NodeName = ""
+
+	parkedPod := &corev1.Pod{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Pod",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        pod.Name,
+			Namespace:   pod.Namespace,
+			Labels:      pod.Labels,
+			Annotations: pod.Annotations,
+		},
+		Spec: *podSpec,
+	}
+
+	podBytes, err := json.Marshal(parkedPod)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal pod %s: %w", pod.Name, err)
+	}
+
+	parkedMeta := AuxiliaryObjectMeta(pod, pod.Name)
+	parkedMeta.Labels[GarmStoppedLabel] = "true"
+
+	return &corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "ConfigMap",
+		},
+		ObjectMeta: parkedMeta,
+		Data: map[string]string{
+			parkedPodKey: string(podBytes),
+		},
+	}, nil
+}
+
+// ParkedConfigMapToPod restores the runner pod stored in a parked ConfigMap
+func ParkedConfigMapToPod(configMap *corev1.ConfigMap) (*corev1.Pod, error) {
+	podBytes, ok := configMap.Data[parkedPodKey]
+	if !ok {
+		return nil, fmt.Errorf("configmap %s does not contain a parked pod", configMap.Name)
+	}
+
+	pod := &corev1.Pod{}
+	if err := json.Unmarshal([]byte(podBytes), pod); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal parked pod %s: %w", configMap.Name, err)
+	}
+	return pod, nil
+}
+
+// PodStartupState reports if the pod is scheduled and the given container has been started.
+// An error is returned if the pod or one of its containers failed to start.
+func PodStartupState(pod *corev1.Pod, containerName string) (bool, error) {
+	switch pod.Status.Phase {
+	case corev1.PodFailed:
+		return false, fmt.Errorf("pod %s failed: %s", pod.Name, joinReason(pod.Status.Reason, pod.Status.Message))
+	case corev1.PodSucceeded:
+		return true, nil
+	}
+
+	if failure := containerFailure(pod); failure != "" {
+		return false, fmt.Errorf("pod %s can not be started: %s", pod.Name, failure)
+	}
+
+	if !isPodScheduled(pod) {
+		return false, nil
+	}
+
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == containerName {
+			return status.State.Running != nil || status.State.Terminated != nil, nil
+		}
+	}
+	return false, nil
+}
+
+// PodPendingReason describes why a pod is not started yet
+func PodPendingReason(pod *corev1.Pod) string {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodScheduled && condition.Status == corev1.ConditionFalse {
+			return joinReason(condition.Reason, condition.Message)
+		}
+	}
+
+	for _, status := range append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...) {
+		if status.State.Waiting != nil && status.State.Waiting.Reason != "" {
+			return fmt.Sprintf("container %s: %s", status.Name, joinReason(status.State.Waiting.Reason, status.State.Waiting.Message))
+		}
+	}
+
+	if pod.Status.Phase == "" {
+		return "pod has no status yet"
+	}
+	return fmt.Sprintf("pod is in phase %s", pod.Status.Phase)
+}
+
+// containerFailure returns a description of the first container
+// which is waiting with one of the containerFailureReasons
+func containerFailure(pod *corev1.Pod) string {
+	for _, status := range append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...) {
+		if status.State.Waiting != nil && containerFailureReasons[status.State.Waiting.Reason] {
+			return fmt.Sprintf("container %s: %s", status.Name, joinReason(status.State.Waiting.Reason, status.State.Waiting.Message))
+		}
+	}
+	return ""
+}
+
+// IsUnhealthy returns true if the instance is neither running nor stopped
+func IsUnhealthy(instance *params.ProviderInstance) bool {
+	switch instance.Status {
+	case params.InstanceRunning, params.InstanceStopped:
+		return false
+	}
+	return true
+}
+
+// HasFault returns true if the instance is unhealthy for a known reason.
+// Pending instances without a fault are just starting up.
+func HasFault(instance *params.ProviderInstance) bool {
+	return IsUnhealthy(instance) && (instance.Status != params.InstancePendingCreate || len(instance.ProviderFault) > 0)
+}
+
+// AppendEventsToProviderFault adds a summary of the most recent warning events
+// of the pod to the provider fault of an instance which is not healthy.
+func AppendEventsToProviderFault(instance *params.ProviderInstance, pod *corev1.Pod, events []corev1.Event) {
+	if !IsUnhealthy(instance) {
+		return
+	}
+
+	warnings := make([]corev1.Event, 0, len(events))
+	for _, event := range events {
+		if event.Type != corev1.EventTypeWarning || event.InvolvedObject.Name != pod.Name {
+			continue
+		}
+		// skip events of a former pod with the same name
+		if event.InvolvedObject.UID != "" && pod.UID != "" && event.InvolvedObject.UID != pod.UID {
+			continue
+		}
+		warnings = append(warnings, event)
+	}
+	if len(warnings) == 0 {
+		return
+	}
+
+	sort.SliceStable(warnings, func(i, j int) bool {
+		return eventTime(warnings[i]).After(eventTime(warnings[j]))
+	})
+	if len(warnings) > maxProviderFaultEvents {
+		warnings = warnings[:maxProviderFaultEvents]
+	}
+
+	summaries := make([]string, 0, len(warnings)+1)
+	if len(instance.ProviderFault) > 0 {
+		summaries = append(summaries, string(instance.ProviderFault))
+	}
+	for _, event := range warnings {
+		reason := event.Reason
+		if event.Count > 1 {
+			reason = fmt.Sprintf("%s (x%d)", event.Reason, event.Count)
+		}
+		summaries = append(summaries, joinReason(reason, strings.TrimSpace(event.Message)))
+	}
+
+	instance.ProviderFault = []byte(strings.Join(summaries, "; "))
+}
+
+// eventTime returns the time an event was seen the last time
+func eventTime(event corev1.Event) time.Time {
+	switch {
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	default:
+		return event.FirstTimestamp.Time
+	}
+}
+
+// containerTermination returns a description of the first container
+// which terminated with a non-zero exit code
+func containerTermination(pod *corev1.Pod) string {
+	for _, status := range pod.Status.ContainerStatuses {
+		terminated := status.State.Terminated
+		if terminated != nil && terminated.ExitCode != 0 {
+			return fmt.Sprintf("container %s terminated with exit code %d: %s", status.Name, terminated.ExitCode, joinReason(terminated.Reason, terminated.Message))
+		}
+	}
+	return ""
+}
+
+func isPodScheduled(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodScheduled {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+func joinReason(reason, message string) string {
+	switch {
+	case reason == "":
+		return message
+	case message == "":
+		return reason
+	default:
+		return reason + ": " + message
+	}
+}
@@ -3,81 +3,333 @@
 package config
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
 
-	koanfYaml "github.com/knadh/koanf/parsers/yaml"
-	"github.com/knadh/koanf/providers/file"
+	"github.com/go-viper/mapstructure/v2"
 	"github.com/knadh/koanf/v2"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/validation"
-	k8sYaml "k8s.io/apimachinery/pkg/util/yaml"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/yaml"
 )
 
+const (
+	// RunnerInstallModeImage expects the runner to be baked into the runner image
+	RunnerInstallModeImage = "image"
+	// RunnerInstallModeTools installs the runner from the tools passed by garm
+	RunnerInstallModeTools = "tools"
+
+	// defaultToolsInstallerImage is pinned, so runner installs don't change with new curl releases
+	defaultToolsInstallerImage = "curlimages/curl:8.16.0"
+
+	// UnknownFlavorPolicyReject fails creating instances of pools with an unknown flavor
+	UnknownFlavorPolicyReject = "reject"
+	// UnknownFlavorPolicyDefaultFlavor applies the defaultFlavor to pools with an unknown flavor
+	UnknownFlavorPolicyDefaultFlavor = "default-flavor"
+	// UnknownFlavorPolicyBestEffort creates the runner pods of pools with an unknown flavor without resource requirements
+	UnknownFlavorPolicyBestEffort = "best-effort"
+)
+
 type ProviderConfig struct {
-	KubeConfigPath  string                                 `koanf:"kubeConfigPath"`
-	RunnerNamespace string                                 `koanf:"runnerNamespace"`
-	PodTemplate     corev1.PodTemplateSpec                 `koanf:"podTemplate"`
-	Flavors         map[string]corev1.ResourceRequirements `koanf:"flavors"`
+	KubeConfigPath string `koanf:"kubeConfigPath"`
+	// KubeContext selects a context of the kubeconfig instead of its current context
+	KubeContext string `koanf:"kubeContext"`
+	// KubeConfig is an inline kubeconfig, used instead of KubeConfigPath
+	KubeConfig string `koanf:"kubeConfig"`
+	// APIServerURL, BearerTokenFile and CAFile configure the connection to a cluster without a kubeconfig,
+	// e.g. with a projected service account token of another cluster
+	APIServerURL    string                            `koanf:"apiServerURL"`
+	BearerTokenFile string                            `koanf:"bearerTokenFile"`
+	CAFile          string                            `koanf:"caFile"`
+	RunnerNamespace string                            `koanf:"runnerNamespace"`
+	PodTemplate     corev1.PodTemplateSpec            `koanf:"podTemplate"`
+	PodTemplates    map[string]corev1.PodTemplateSpec `koanf:"podTemplates"`
+	Flavors         map[string]Flavor                 `koanf:"flavors"`
+	// UnknownFlavorPolicy defines how pools with a flavor which is not configured in Flavors,
+	// PodTemplates or the Flavors of a cluster are handled,
+	// either rejected, given the DefaultFlavor or created as BestEffort pods, which is the default.
+	UnknownFlavorPolicy string `koanf:"unknownFlavorPolicy"`
+	// DefaultFlavor is applied to pools with an unknown flavor by the default-flavor policy
+	DefaultFlavor string `koanf:"defaultFlavor"`
+	// PodReadyTimeout is the time CreateInstance waits for the runner pod
+	// to be scheduled and the runner container to be started.
+	// Waiting is disabled if set to zero.
+	PodReadyTimeout time.Duration `koanf:"podReadyTimeout"`
+	// OperationTimeout is the deadline of a single provider command,
+	// including all kubernetes API calls and waiting for the runner pod.
+	// No deadline besides the one of garm is set if zero.
+	OperationTimeout time.Duration `koanf:"operationTimeout"`
+	// RunnerInstallMode defines how the runner gets into the runner container,
+	// either baked into the image or installed from the garm tools by an init container.
+	// Pools can override it with runnerInstallMode in their extra_specs.
+	RunnerInstallMode string `koanf:"runnerInstallMode"`
+	// ToolsInstallerImage is the image of the init container which installs the runner
+	// in tools mode. It needs sh, curl, sha256sum and tar.
+	ToolsInstallerImage string `koanf:"toolsInstallerImage"`
+	// DeleteConcurrency is the number of pods RemoveAllInstances deletes in parallel, 10 if not set.
+	DeleteConcurrency int `koanf:"deleteConcurrency"`
+	// DeleteTimeout is the time RemoveAllInstances waits for the deleted pods to be gone, 2m if not set.
+	DeleteTimeout time.Duration `koanf:"deleteTimeout"`
+	// GracePeriodSeconds overrides the termination grace period of the runner pods on deletion,
+	// e.g. to give a runner killed mid-job enough time to deregister.
+	GracePeriodSeconds *int64 `koanf:"gracePeriodSeconds"`
+	// PropagationPolicy is the propagation policy of pod deletions: Orphan, Background or Foreground.
+	PropagationPolicy string `koanf:"propagationPolicy"`
+	// ForceDeleteAfter escalates the deletion of a pod which is terminating longer than this
+	// to a deletion without grace period. Disabled if zero.
+	ForceDeleteAfter time.Duration `koanf:"forceDeleteAfter"`
+	// ForceDeleteOnNodeNotReady deletes pods on NotReady nodes without grace period,
+	// as the kubelet will never confirm their deletion. Needs permission to get nodes.
+	ForceDeleteOnNodeNotReady bool `koanf:"forceDeleteOnNodeNotReady"`
+	// DeregistrationCommand is run by a preStop hook in the runner container before it gets stopped,
+	// e.g. to remove the runner from GitHub. DeleteInstance waits for the pod to be gone if set.
+	DeregistrationCommand []string `koanf:"deregistrationCommand"`
+	// DeregistrationTimeout is the time the deregistration command may take, if set it raises
+	// the termination grace period of the runner pods. DeleteInstance waits deleteTimeout otherwise.
+	DeregistrationTimeout time.Duration `koanf:"deregistrationTimeout"`
+	// QPS and Burst limit the requests to the kubernetes API of each cluster.
+	// The client-go defaults are used if not set.
+	QPS   float32 `koanf:"qps"`
+	Burst int     `koanf:"burst"`
+	// Clusters are additional named clusters runner pods can be routed to.
+	// Pools without a matching cluster run in the cluster of KubeConfigPath.
+	Clusters map[string]ClusterConfig `koanf:"clusters"`
 }
 
-var Config ProviderConfig
+// Flavor configures the runner pods of pools with the flavor.
+// The resource requirements of the runner container are inlined, so any resource
+// like ephemeral-storage or extended resources like nvidia.com/gpu can be requested.
+type Flavor struct {
+	corev1.ResourceRequirements `json:",inline"`
+	// NodeSelector, Tolerations, Affinity, PriorityClassName and RuntimeClassName
+	// are set on the runner pod, so the flavor lands on the right node pool
+	NodeSelector      map[string]string   `json:"nodeSelector,omitempty"`
+	Tolerations       []corev1.Toleration `json:"tolerations,omitempty"`
+	Affinity          *corev1.Affinity    `json:"affinity,omitempty"`
+	PriorityClassName string              `json:"priorityClassName,omitempty"`
+	RuntimeClassName  *string             `json:"runtimeClassName,omitempty"`
+	// PodTemplate is merged into the runner pod, the fields above take precedence over it
+	PodTemplate corev1.PodTemplateSpec `json:"podTemplate,omitempty"`
+}
 
-func NewConfig(configPath string) error {
-	k := koanf.New(".")
+// ClusterConfig configures a named cluster runner pods can be routed to,
+// either by the cluster in the extra_specs of a pool or by the flavor of a pool
+type ClusterConfig struct {
+	KubeConfigPath  string `koanf:"kubeConfigPath"`
+	KubeContext     string `koanf:"kubeContext"`
+	KubeConfig      string `koanf:"kubeConfig"`
+	APIServerURL    string `koanf:"apiServerURL"`
+	BearerTokenFile string `koanf:"bearerTokenFile"`
+	CAFile          string `koanf:"caFile"`
+	// RunnerNamespace defaults to the runnerNamespace of the provider config
+	RunnerNamespace string   `koanf:"runnerNamespace"`
+	Flavors         []string `koanf:"flavors"`
+}
 
-	if configPath == "" {
-		return errors.New("no config file path provided")
+// NewConfig loads and validates the provider config from the given path,
+// merged with its overlay files and environment overrides. It is called by every
+// provider command, garm runs each of them in a new process, so there is nothing to reload.
+func NewConfig(configPath string) (*ProviderConfig, error) {
+	k, err := load(configPath)
+	if err != nil {
+		return nil, err
 	}
+	return decode(k)
+}
 
-	// load the config file
-	if err := k.Load(file.Provider(configPath), koanfYaml.Parser()); err != nil {
-		return err
-	}
+// decode decodes and validates the merged config
+func decode(k *koanf.Koanf) (*ProviderConfig, error) {
+	cfg := &ProviderConfig{}
 
 	// clear out flavors & podTemplate key so koanf does not try to unmarshal them later,
 	// as koanf has trouble unmarshalling yaml into a corev1.ResourceRequirements struct
-	Config.Flavors = unmarshalFlavors(k)
+	flavors, err := decodeMapStrict[Flavor](k, "flavors")
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode config: %w", err)
+	}
+	cfg.Flavors = flavors
 	k.Delete("flavors")
 
-	Config.PodTemplate = unmarshalPodTemplateSpec(k)
+	if err := decodeStrict(k, "podTemplate", &cfg.PodTemplate); err != nil {
+		return nil, fmt.Errorf("failed to decode config: %w", err)
+	}
 	k.Delete("podTemplate")
 
-	// unmarshal all koanf config keys into ProviderConfig struct
-	if err := k.Unmarshal("", &Config); err != nil {
-		return fmt.Errorf("failed to unmarshal config: %v", err)
+	podTemplates, err := decodeMapStrict[corev1.PodTemplateSpec](k, "podTemplates")
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode config: %w", err)
+	}
+	cfg.PodTemplates = podTemplates
+	k.Delete("podTemplates")
+
+	// unmarshal all koanf config keys into ProviderConfig struct, unknown keys are an error
+	err = k.UnmarshalWithConf("", cfg, koanf.UnmarshalConf{
+		DecoderConfig: &mapstructure.DecoderConfig{
+			DecodeHook: mapstructure.ComposeDecodeHookFunc(
+				mapstructure.StringToTimeDurationHookFunc(),
+				mapstructure.TextUnmarshallerHookFunc()),
+			ErrorUnused:      true,
+			WeaklyTypedInput: true,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal config: %v", err)
 	}
 
 	// set the default namespace for runners
-	if Config.RunnerNamespace == "" {
-		Config.RunnerNamespace = "runner"
+	if cfg.RunnerNamespace == "" {
+		cfg.RunnerNamespace = "runner"
+	}
+
+	if cfg.RunnerInstallMode == "" {
+		cfg.RunnerInstallMode = RunnerInstallModeImage
+	}
+
+	if cfg.ToolsInstallerImage == "" {
+		cfg.ToolsInstallerImage = defaultToolsInstallerImage
+	}
+
+	if cfg.UnknownFlavorPolicy == "" {
+		cfg.UnknownFlavorPolicy = UnknownFlavorPolicyBestEffort
 	}
 
 	// will clear out the containers field in the merge. We don't want that.
-	if Config.PodTemplate.Spec.Containers == nil {
-		Config.PodTemplate.Spec.Containers = []corev1.Container{}
+	if cfg.PodTemplate.Spec.Containers == nil {
+		cfg.PodTemplate.Spec.Containers = []corev1.Container{}
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// validate validates the provider config and defaults the runner namespace of its clusters
+func (c *ProviderConfig) validate() error {
+	if c.PodReadyTimeout < 0 {
+		return fmt.Errorf("podReadyTimeout must not be negative: %s", c.PodReadyTimeout)
+	}
+
+	if c.OperationTimeout < 0 {
+		return fmt.Errorf("operationTimeout must not be negative: %s", c.OperationTimeout)
+	}
+
+	if c.DeleteConcurrency < 0 || c.DeleteTimeout < 0 {
+		return fmt.Errorf("deleteConcurrency and deleteTimeout must not be negative: %d, %s", c.DeleteConcurrency, c.DeleteTimeout)
+	}
+
+	if c.GracePeriodSeconds != nil && *c.GracePeriodSeconds < 0 {
+		return fmt.Errorf("gracePeriodSeconds must not be negative: %d", *c.GracePeriodSeconds)
+	}
+
+	if c.ForceDeleteAfter < 0 {
+		return fmt.Errorf("forceDeleteAfter must not be negative: %s", c.ForceDeleteAfter)
+	}
+
+	switch metav1.DeletionPropagation(c.PropagationPolicy) {
+	case "", metav1.DeletePropagationOrphan, metav1.DeletePropagationBackground, metav1.DeletePropagationForeground:
+	default:
+		return fmt.Errorf("invalid propagationPolicy %q: must be one of %s, %s or %s", c.PropagationPolicy, metav1.DeletePropagationOrphan, metav1.DeletePropagationBackground, metav1.DeletePropagationForeground)
+	}
+
+	if c.DeregistrationTimeout < 0 {
+		return fmt.Errorf("deregistrationTimeout must not be negative: %s", c.DeregistrationTimeout)
+	}
+
+	if c.QPS < 0 || c.Burst < 0 {
+		return fmt.Errorf("qps and burst must not be negative: %v, %d", c.QPS, c.Burst)
+	}
+
+	err := ValidateRunnerInstallMode(c.RunnerInstallMode)
+	if err != nil {
+		return err
 	}
 
 	// validate the given runner namespace
-	err := validateNamespace(Config.RunnerNamespace)
+	err = validateNamespace(c.RunnerNamespace)
 	if err != nil {
 		return fmt.Errorf("failed to validate namespace: %v", err)
 	}
 
+	err = validateConnection(c.DefaultCluster())
+	if err != nil {
+		return fmt.Errorf("failed to validate connection: %v", err)
+	}
+
+	err = c.validateClusters()
+	if err != nil {
+		return err
+	}
+
 	// validate the pod template spec
-	err = validatePodTemplate()
+	err = validatePodTemplate(c.PodTemplate)
 	if err != nil {
 		return fmt.Errorf("failed to marshal PodTemplate into bytes: %v", err)
 	}
+
+	// validate the named pod template specs
+	for name, podTemplate := range c.PodTemplates {
+		err = validatePodTemplate(podTemplate)
+		if err != nil {
+			return fmt.Errorf("failed to validate podTemplates entry %s: %v", name, err)
+		}
+	}
+
+	// validate the pod template fragments of the flavors
+	for name, flavor := range c.Flavors {
+		err = validatePodTemplate(flavor.PodTemplate)
+		if err != nil {
+			return fmt.Errorf("failed to validate podTemplate of flavor %s: %v", name, err)
+		}
+	}
+
+	return c.validateUnknownFlavorPolicy()
+}
+
+// validateUnknownFlavorPolicy validates the unknown flavor policy and the default flavor it may refer to
+func (c *ProviderConfig) validateUnknownFlavorPolicy() error {
+	switch c.UnknownFlavorPolicy {
+	case UnknownFlavorPolicyReject, UnknownFlavorPolicyBestEffort:
+	case UnknownFlavorPolicyDefaultFlavor:
+		if c.DefaultFlavor == "" {
+			return fmt.Errorf("unknownFlavorPolicy %s requires a defaultFlavor", UnknownFlavorPolicyDefaultFlavor)
+		}
+	default:
+		return fmt.Errorf("unknownFlavorPolicy %s is invalid, must be one of %s, %s, %s", c.UnknownFlavorPolicy, UnknownFlavorPolicyReject, UnknownFlavorPolicyDefaultFlavor, UnknownFlavorPolicyBestEffort)
+	}
+
+	if c.DefaultFlavor != "" && !c.KnownFlavor(c.DefaultFlavor) {
+		return fmt.Errorf("defaultFlavor %s is not configured in flavors, podTemplates or the flavors of a cluster", c.DefaultFlavor)
+	}
 	return nil
 }
 
+// KnownFlavor reports if a flavor is configured in flavors, as a named pod template
+// or for the routing to a cluster
+func (c ProviderConfig) KnownFlavor(flavor string) bool {
+	if _, ok := c.Flavors[flavor]; ok {
+		return true
+	}
+	if _, ok := c.PodTemplates[flavor]; ok {
+		return true
+	}
+	for _, cluster := range c.Clusters {
+		if slices.Contains(cluster.Flavors, flavor) {
+			return true
+		}
+	}
+	return false
+}
+
 // validatePodTemplate validates the pod template spec
 // by unmarshalling it into a corev1.PodTemplateSpec
-func validatePodTemplate() error {
-	podTemplate, err := yaml.Marshal(Config.PodTemplate)
+func validatePodTemplate(template corev1.PodTemplateSpec) error {
+	podTemplate, err := yaml.Marshal(template)
 	if err != nil {
 		return fmt.Errorf("failed to marshal PodTemplate into bytes: %v", err)
 	}
@@ -89,6 +341,87 @@ func validatePodTemplate() error {
 	return nil
 }
 
+// ValidateRunnerInstallMode checks if the given runner install mode is supported
+func ValidateRunnerInstallMode(mode string) error {
+	switch mode {
+	case RunnerInstallModeImage, RunnerInstallModeTools:
+		return nil
+	default:
+		return fmt.Errorf("runnerInstallMode %s is invalid, must be one of %s, %s", mode, RunnerInstallModeImage, RunnerInstallModeTools)
+	}
+}
+
+// DefaultCluster returns the connection to the default cluster
+// configured at the top level of the provider config
+func (c ProviderConfig) DefaultCluster() ClusterConfig {
+	return ClusterConfig{
+		KubeConfigPath:  c.KubeConfigPath,
+		KubeContext:     c.KubeContext,
+		KubeConfig:      c.KubeConfig,
+		APIServerURL:    c.APIServerURL,
+		BearerTokenFile: c.BearerTokenFile,
+		CAFile:          c.CAFile,
+		RunnerNamespace: c.RunnerNamespace,
+	}
+}
+
+// validateConnection checks that a cluster connection is configured in only one way
+func validateConnection(cluster ClusterConfig) error {
+	sources := 0
+	for _, source := range []string{cluster.KubeConfigPath, cluster.KubeConfig, cluster.APIServerURL} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return errors.New("only one of kubeConfigPath, kubeConfig and apiServerURL can be set")
+	}
+
+	if cluster.KubeContext != "" && cluster.KubeConfigPath == "" && cluster.KubeConfig == "" {
+		return errors.New("kubeContext requires kubeConfigPath or kubeConfig")
+	}
+
+	if cluster.APIServerURL == "" && (cluster.BearerTokenFile != "" || cluster.CAFile != "") {
+		return errors.New("bearerTokenFile and caFile require apiServerURL")
+	}
+	if cluster.APIServerURL != "" && cluster.BearerTokenFile == "" {
+		return errors.New("apiServerURL requires bearerTokenFile")
+	}
+	return nil
+}
+
+// validateClusters validates the named clusters
+// and defaults their runner namespace
+func (c *ProviderConfig) validateClusters() error {
+	flavorClusters := map[string]string{}
+	for name, cluster := range c.Clusters {
+		if name == "" || strings.Contains(name, "/") {
+			return fmt.Errorf("cluster name %q is invalid, it must not be empty or contain a slash", name)
+		}
+
+		if err := validateConnection(cluster); err != nil {
+			return fmt.Errorf("failed to validate connection of cluster %s: %v", name, err)
+		}
+
+		if cluster.RunnerNamespace == "" {
+			cluster.RunnerNamespace = c.RunnerNamespace
+		}
+		if err := validateNamespace(cluster.RunnerNamespace); err != nil {
+			return fmt.Errorf("failed to validate namespace of cluster %s: %v", name, err)
+		}
+
+		for _, flavor := range cluster.Flavors {
+			if other, ok := flavorClusters[flavor]; ok {
+				return fmt.Errorf("flavor %s is routed to cluster %s and %s", flavor, other, name)
+			}
+			flavorClusters[flavor] = name
+		}
+
+		c.Clusters[name] = cluster
+	}
+	return nil
+}
+
 // validateNamespace validates the namespace
 // by checking if it is a valid DNS subdomain
 func validateNamespace(namespace string) error {
@@ -102,51 +435,54 @@ func validateNamespace(namespace string) error {
 	return nil
 }
 
-func unmarshalPodTemplateSpec(k *koanf.Koanf) corev1.PodTemplateSpec {
-	defaultSpec := corev1.PodTemplateSpec{
-		Spec: corev1.PodSpec{
-			Containers: []corev1.Container{},
-		},
+// decodeStrict decodes the value of the given key into out.
+// Unknown fields, invalid quantities and values of the wrong type are errors.
+func decodeStrict(k *koanf.Koanf, key string, out any) error {
+	value := k.Get(key)
+	if value == nil {
+		return nil
 	}
 
-	// Extract the podTemplate as a raw map
-	podTemplateMap := k.Get("podTemplate")
-	if podTemplateMap == nil {
-		return defaultSpec
+	if err := decodeValueStrict(value, out); err != nil {
+		return fmt.Errorf("%s: %w", key, err)
 	}
+	return nil
+}
 
-	// Convert the map to a YAML string
-	podTemplateYAML, err := yaml.Marshal(podTemplateMap)
-	if err != nil {
-		return defaultSpec
+// decodeMapStrict decodes each entry of the map at the given key strictly,
+// so errors point to the entry they occurred in
+func decodeMapStrict[T any](k *koanf.Koanf, key string) (map[string]T, error) {
+	value := k.Get(key)
+	if value == nil {
+		return nil, nil
 	}
 
-	var podTemplate corev1.PodTemplateSpec
-	decoder := k8sYaml.NewYAMLOrJSONDecoder(bytes.NewReader(podTemplateYAML), len(podTemplateYAML))
-	if err := decoder.Decode(&podTemplate); err != nil {
-		return defaultSpec
+	entries, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: must be a map, got %T", key, value)
 	}
-	return podTemplate
-}
-
-func unmarshalFlavors(k *koanf.Koanf) map[string]corev1.ResourceRequirements {
-	var result map[string]corev1.ResourceRequirements
 
-	// Extract the podTemplate as a raw map
-	flavorsMap := k.Get("flavors")
-	if flavorsMap == nil {
-		return result
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
 	}
+	sort.Strings(names)
 
-	// Convert the map to a YAML string
-	flavorsYAML, err := yaml.Marshal(flavorsMap)
-	if err != nil {
-		return result
+	result := make(map[string]T, len(entries))
+	for _, name := range names {
+		var entry T
+		if err := decodeValueStrict(entries[name], &entry); err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", key, name, err)
+		}
+		result[name] = entry
 	}
+	return result, nil
+}
 
-	decoder := k8sYaml.NewYAMLOrJSONDecoder(bytes.NewReader(flavorsYAML), len(flavorsYAML))
-	if err := decoder.Decode(&result); err != nil {
-		return result
+func decodeValueStrict(value any, out any) error {
+	valueYAML, err := yaml.Marshal(value)
+	if err != nil {
+		return err
 	}
-	return result
+	return yaml.UnmarshalStrict(valueYAML, out)
 }
@@ -3,14 +3,19 @@
 package config_test
 
 import (
+	"encoding/json"
 	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
 
 	"github.com/mercedes-benz/garm-provider-k8s/pkg/config"
 )
@@ -25,8 +30,11 @@ func TestGetConfig(t *testing.T) {
 		{
 			name: "valid configuration withouth PodTemplateSpec",
 			expected: config.ProviderConfig{
-				KubeConfigPath:  "/path/to/kubeconfig",
-				RunnerNamespace: "test-namespace",
+				KubeConfigPath:      "/path/to/kubeconfig",
+				RunnerNamespace:     "test-namespace",
+				RunnerInstallMode:   "image",
+				ToolsInstallerImage: "curlimages/curl:8.16.0",
+				UnknownFlavorPolicy: "best-effort",
 				PodTemplate: corev1.PodTemplateSpec{
 					Spec: corev1.PodSpec{
 						Containers: []corev1.Container{},
@@ -41,8 +49,11 @@ runnerNamespace: "test-namespace"
 		{
 			name: "valid configuration - expect default namespace",
 			expected: config.ProviderConfig{
-				KubeConfigPath:  "/path/to/kubeconfig",
-				RunnerNamespace: "runner",
+				KubeConfigPath:      "/path/to/kubeconfig",
+				RunnerNamespace:     "runner",
+				RunnerInstallMode:   "image",
+				ToolsInstallerImage: "curlimages/curl:8.16.0",
+				UnknownFlavorPolicy: "best-effort",
 				PodTemplate: corev1.PodTemplateSpec{
 					Spec: corev1.PodSpec{
 						Containers: []corev1.Container{},
@@ -56,8 +67,11 @@ kubeConfigPath: "/path/to/kubeconfig"
 		{
 			name: "valid configuration without a defined registry is fine - using configured container runtime registries",
 			expected: config.ProviderConfig{
-				KubeConfigPath:  "/path/to/kubeconfig",
-				RunnerNamespace: "runner",
+				KubeConfigPath:      "/path/to/kubeconfig",
+				RunnerNamespace:     "runner",
+				RunnerInstallMode:   "image",
+				ToolsInstallerImage: "curlimages/curl:8.16.0",
+				UnknownFlavorPolicy: "best-effort",
 				PodTemplate: corev1.PodTemplateSpec{
 					Spec: corev1.PodSpec{
 						Containers: []corev1.Container{},
@@ -72,8 +86,11 @@ runnerNamespace: "runner"
 		{
 			name: "invalid configuration with a invalid namespace name",
 			expected: config.ProviderConfig{
-				KubeConfigPath:  "/path/to/kubeconfig",
-				RunnerNamespace: "runner",
+				KubeConfigPath:      "/path/to/kubeconfig",
+				RunnerNamespace:     "runner",
+				RunnerInstallMode:   "image",
+				ToolsInstallerImage: "curlimages/curl:8.16.0",
+				UnknownFlavorPolicy: "best-effort",
 				PodTemplate: corev1.PodTemplateSpec{
 					Spec: corev1.PodSpec{
 						Containers: []corev1.Container{},
@@ -89,15 +106,18 @@ runnerNamespace: "this_is_An_invalid_namespace_name"
 		{
 			name: "valid configuration with custom flavor to resource requirements mapping",
 			expected: config.ProviderConfig{
-				KubeConfigPath:  "/path/to/kubeconfig",
-				RunnerNamespace: "runner",
+				KubeConfigPath:      "/path/to/kubeconfig",
+				RunnerNamespace:     "runner",
+				RunnerInstallMode:   "image",
+				ToolsInstallerImage: "curlimages/curl:8.16.0",
+				UnknownFlavorPolicy: "best-effort",
 				PodTemplate: corev1.PodTemplateSpec{
 					Spec: corev1.PodSpec{
 						Containers: []corev1.Container{},
 					},
 				},
-				Flavors: map[string]corev1.ResourceRequirements{
-					"micro": {
+				Flavors: map[string]config.Flavor{
+					"micro": {ResourceRequirements: corev1.ResourceRequirements{
 						Limits: corev1.ResourceList{
 							corev1.ResourceMemory: resource.MustParse("200Mi"),
 						},
@@ -105,8 +125,8 @@ runnerNamespace: "this_is_An_invalid_namespace_name"
 							corev1.ResourceCPU:    resource.MustParse("50m"),
 							corev1.ResourceMemory: resource.MustParse("50Mi"),
 						},
-					},
-					"large": {
+					}},
+					"large": {ResourceRequirements: corev1.ResourceRequirements{
 						Limits: corev1.ResourceList{
 							corev1.ResourceMemory: resource.MustParse("1Gi"),
 						},
@@ -114,7 +134,7 @@ runnerNamespace: "this_is_An_invalid_namespace_name"
 							corev1.ResourceCPU:    resource.MustParse("1000m"),
 							corev1.ResourceMemory: resource.MustParse("500Mi"),
 						},
-					},
+					}},
 				},
 			},
 			config: `
@@ -139,8 +159,11 @@ flavors:
 		{
 			name: "valid configuration with extra livenessProbe",
 			expected: config.ProviderConfig{
-				KubeConfigPath:  "/path/to/kubeconfig",
-				RunnerNamespace: "runner",
+				KubeConfigPath:      "/path/to/kubeconfig",
+				RunnerNamespace:     "runner",
+				RunnerInstallMode:   "image",
+				ToolsInstallerImage: "curlimages/curl:8.16.0",
+				UnknownFlavorPolicy: "best-effort",
 				PodTemplate: corev1.PodTemplateSpec{
 					Spec: corev1.PodSpec{
 						Containers: []corev1.Container{
@@ -186,8 +209,11 @@ podTemplate:
 		{
 			name: "valid configuration with additional pod labels",
 			expected: config.ProviderConfig{
-				KubeConfigPath:  "/path/to/kubeconfig",
-				RunnerNamespace: "runner",
+				KubeConfigPath:      "/path/to/kubeconfig",
+				RunnerNamespace:     "runner",
+				RunnerInstallMode:   "image",
+				ToolsInstallerImage: "curlimages/curl:8.16.0",
+				UnknownFlavorPolicy: "best-effort",
 				PodTemplate: corev1.PodTemplateSpec{
 					ObjectMeta: metav1.ObjectMeta{
 						Labels: map[string]string{
@@ -211,6 +237,642 @@ podTemplate:
 `,
 			wantError: false,
 		},
+		{
+			name: "valid configuration with named pod templates",
+			expected: config.ProviderConfig{
+				KubeConfigPath:      "/path/to/kubeconfig",
+				RunnerNamespace:     "runner",
+				RunnerInstallMode:   "image",
+				ToolsInstallerImage: "curlimages/curl:8.16.0",
+				UnknownFlavorPolicy: "best-effort",
+				PodTemplate: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{},
+					},
+				},
+				PodTemplates: map[string]corev1.PodTemplateSpec{
+					"dind": {
+						Spec: corev1.PodSpec{
+							Containers: []corev1.Container{
+								{
+									Name:  "docker",
+									Image: "docker:dind",
+								},
+							},
+						},
+					},
+					"lint": {
+						Spec: corev1.PodSpec{
+							NodeSelector: map[string]string{
+								"node-role": "lightweight",
+							},
+						},
+					},
+				},
+			},
+			config: `
+kubeConfigPath: "/path/to/kubeconfig"
+runnerNamespace: "runner"
+podTemplates:
+  dind:
+    spec:
+      containers:
+      - name: docker
+        image: docker:dind
+  lint:
+    spec:
+      nodeSelector:
+        node-role: lightweight
+`,
+			wantError: false,
+		},
+		{
+			name: "valid configuration with pod ready timeout",
+			expected: config.ProviderConfig{
+				KubeConfigPath:      "/path/to/kubeconfig",
+				RunnerNamespace:     "runner",
+				RunnerInstallMode:   "image",
+				ToolsInstallerImage: "curlimages/curl:8.16.0",
+				UnknownFlavorPolicy: "best-effort",
+				PodTemplate: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{},
+					},
+				},
+				PodReadyTimeout: 2 * time.Minute,
+			},
+			config: `
+kubeConfigPath: "/path/to/kubeconfig"
+podReadyTimeout: 2m
+`,
+			wantError: false,
+		},
+		{
+			name: "valid configuration with operation timeout",
+			expected: config.ProviderConfig{
+				KubeConfigPath:      "/path/to/kubeconfig",
+				RunnerNamespace:     "runner",
+				RunnerInstallMode:   "image",
+				ToolsInstallerImage: "curlimages/curl:8.16.0",
+				UnknownFlavorPolicy: "best-effort",
+				PodTemplate: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{},
+					},
+				},
+				OperationTimeout: 5 * time.Minute,
+			},
+			config: `
+kubeConfigPath: "/path/to/kubeconfig"
+operationTimeout: 5m
+`,
+			wantError: false,
+		},
+		{
+			name: "valid configuration with runner install mode tools",
+			expected: config.ProviderConfig{
+				KubeConfigPath:      "/path/to/kubeconfig",
+				RunnerNamespace:     "runner",
+				RunnerInstallMode:   "tools",
+				ToolsInstallerImage: "registry.example.com/tools-installer:1.0",
+				UnknownFlavorPolicy: "best-effort",
+				PodTemplate: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{},
+					},
+				},
+			},
+			config: `
+kubeConfigPath: "/path/to/kubeconfig"
+runnerInstallMode: tools
+toolsInstallerImage: registry.example.com/tools-installer:1.0
+`,
+			wantError: false,
+		},
+		{
+			name: "valid configuration with named clusters",
+			expected: config.ProviderConfig{
+				KubeConfigPath:      "/path/to/kubeconfig",
+				RunnerNamespace:     "runner",
+				RunnerInstallMode:   "image",
+				ToolsInstallerImage: "curlimages/curl:8.16.0",
+				UnknownFlavorPolicy: "best-effort",
+				PodTemplate: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{},
+					},
+				},
+				Clusters: map[string]config.ClusterConfig{
+					"arm": {
+						KubeConfigPath:  "/path/to/arm-kubeconfig",
+						KubeContext:     "arm-cluster",
+						RunnerNamespace: "arm-runner",
+						Flavors:         []string{"arm64-small", "arm64-large"},
+					},
+					"gpu": {
+						KubeConfigPath:  "/path/to/kubeconfig",
+						KubeContext:     "gpu-cluster",
+						RunnerNamespace: "runner",
+					},
+				},
+			},
+			config: `
+kubeConfigPath: "/path/to/kubeconfig"
+clusters:
+  arm:
+    kubeConfigPath: /path/to/arm-kubeconfig
+    kubeContext: arm-cluster
+    runnerNamespace: arm-runner
+    flavors:
+    - arm64-small
+    - arm64-large
+  gpu:
+    kubeConfigPath: /path/to/kubeconfig
+    kubeContext: gpu-cluster
+`,
+			wantError: false,
+		},
+		{
+			name: "valid configuration with kube context and inline kubeconfig",
+			expected: config.ProviderConfig{
+				KubeContext:         "runner-cluster",
+				KubeConfig:          "apiVersion: v1\nkind: Config\n",
+				RunnerNamespace:     "runner",
+				RunnerInstallMode:   "image",
+				ToolsInstallerImage: "curlimages/curl:8.16.0",
+				UnknownFlavorPolicy: "best-effort",
+				PodTemplate: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{},
+					},
+				},
+			},
+			config: `
+kubeContext: runner-cluster
+kubeConfig: |
+  apiVersion: v1
+  kind: Config
+`,
+			wantError: false,
+		},
+		{
+			name: "valid configuration with api server url and bearer token file",
+			expected: config.ProviderConfig{
+				APIServerURL:        "https://kubernetes.example.com:6443",
+				BearerTokenFile:     "/var/run/secrets/tokens/garm",
+				CAFile:              "/var/run/secrets/tokens/ca.crt",
+				RunnerNamespace:     "runner",
+				RunnerInstallMode:   "image",
+				ToolsInstallerImage: "curlimages/curl:8.16.0",
+				UnknownFlavorPolicy: "best-effort",
+				PodTemplate: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{},
+					},
+				},
+			},
+			config: `
+apiServerURL: https://kubernetes.example.com:6443
+bearerTokenFile: /var/run/secrets/tokens/garm
+caFile: /var/run/secrets/tokens/ca.crt
+`,
+			wantError: false,
+		},
+		{
+			name: "invalid configuration with kubeconfig path and inline kubeconfig",
+			config: `
+kubeConfigPath: "/path/to/kubeconfig"
+kubeConfig: |
+  apiVersion: v1
+  kind: Config
+`,
+			wantError: true,
+		},
+		{
+			name: "invalid configuration with api server url without bearer token file",
+			config: `
+apiServerURL: https://kubernetes.example.com:6443
+`,
+			wantError: true,
+		},
+		{
+			name: "invalid configuration with kube context but without kubeconfig",
+			config: `
+kubeContext: runner-cluster
+`,
+			wantError: true,
+		},
+		{
+			name: "invalid configuration with a cluster using bearer token file without api server url",
+			config: `
+clusters:
+  arm:
+    bearerTokenFile: /var/run/secrets/tokens/garm
+`,
+			wantError: true,
+		},
+		{
+			name: "invalid configuration with a flavor routed to two clusters",
+			config: `
+kubeConfigPath: "/path/to/kubeconfig"
+clusters:
+  arm:
+    flavors:
+    - large
+  gpu:
+    flavors:
+    - large
+`,
+			wantError: true,
+		},
+		{
+			name: "invalid configuration with an invalid cluster namespace",
+			config: `
+kubeConfigPath: "/path/to/kubeconfig"
+clusters:
+  arm:
+    runnerNamespace: this_is_An_invalid_namespace_name
+`,
+			wantError: true,
+		},
+		{
+			name: "invalid configuration with unknown runner install mode",
+			config: `
+kubeConfigPath: "/path/to/kubeconfig"
+runnerInstallMode: userdata
+`,
+			wantError: true,
+		},
+		{
+			name: "valid configuration with qps and burst",
+			expected: config.ProviderConfig{
+				KubeConfigPath:      "/path/to/kubeconfig",
+				RunnerNamespace:     "runner",
+				RunnerInstallMode:   "image",
+				ToolsInstallerImage: "curlimages/curl:8.16.0",
+				UnknownFlavorPolicy: "best-effort",
+				PodTemplate: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{},
+					},
+				},
+				QPS:   20,
+				Burst: 40,
+			},
+			config: `
+kubeConfigPath: "/path/to/kubeconfig"
+qps: 20
+burst: 40
+`,
+			wantError: false,
+		},
+		{
+			name: "valid configuration with delete concurrency and timeout",
+			expected: config.ProviderConfig{
+				KubeConfigPath:      "/path/to/kubeconfig",
+				RunnerNamespace:     "runner",
+				RunnerInstallMode:   "image",
+				ToolsInstallerImage: "curlimages/curl:8.16.0",
+				UnknownFlavorPolicy: "best-effort",
+				PodTemplate: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{},
+					},
+				},
+				DeleteConcurrency: 20,
+				DeleteTimeout:     5 * time.Minute,
+			},
+			config: `
+kubeConfigPath: "/path/to/kubeconfig"
+deleteConcurrency: 20
+deleteTimeout: 5m
+`,
+			wantError: false,
+		},
+		{
+			name: "invalid configuration with negative delete concurrency",
+			config: `
+kubeConfigPath: "/path/to/kubeconfig"
+deleteConcurrency: -1
+`,
+			wantError: true,
+		},
+		{
+			name: "valid configuration with delete semantics",
+			expected: config.ProviderConfig{
+				KubeConfigPath:      "/path/to/kubeconfig",
+				RunnerNamespace:     "runner",
+				RunnerInstallMode:   "image",
+				ToolsInstallerImage: "curlimages/curl:8.16.0",
+				UnknownFlavorPolicy: "best-effort",
+				PodTemplate: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{},
+					},
+				},
+				GracePeriodSeconds:        ptr.To[int64](300),
+				PropagationPolicy:         "Background",
+				ForceDeleteAfter:          10 * time.Minute,
+				ForceDeleteOnNodeNotReady: true,
+			},
+			config: `
+kubeConfigPath: "/path/to/kubeconfig"
+gracePeriodSeconds: 300
+propagationPolicy: Background
+forceDeleteAfter: 10m
+forceDeleteOnNodeNotReady: true
+`,
+			wantError: false,
+		},
+		{
+			name: "valid configuration with deregistration hook",
+			expected: config.ProviderConfig{
+				KubeConfigPath:      "/path/to/kubeconfig",
+				RunnerNamespace:     "runner",
+				RunnerInstallMode:   "image",
+				ToolsInstallerImage: "curlimages/curl:8.16.0",
+				UnknownFlavorPolicy: "best-effort",
+				PodTemplate: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{},
+					},
+				},
+				DeregistrationCommand: []string{"/bin/sh", "-c", "/runner/deregister.sh"},
+				DeregistrationTimeout: time.Minute,
+			},
+			config: `
+kubeConfigPath: "/path/to/kubeconfig"
+deregistrationCommand: ["/bin/sh", "-c", "/runner/deregister.sh"]
+deregistrationTimeout: 1m
+`,
+			wantError: false,
+		},
+		{
+			name: "invalid configuration with negative deregistration timeout",
+			config: `
+kubeConfigPath: "/path/to/kubeconfig"
+deregistrationTimeout: -1m
+`,
+			wantError: true,
+		},
+		{
+			name: "invalid configuration with negative grace period",
+			config: `
+kubeConfigPath: "/path/to/kubeconfig"
+gracePeriodSeconds: -1
+`,
+			wantError: true,
+		},
+		{
+			name: "invalid configuration with unknown propagation policy",
+			config: `
+kubeConfigPath: "/path/to/kubeconfig"
+propagationPolicy: Cascade
+`,
+			wantError: true,
+		},
+		{
+			name: "invalid configuration with negative force delete threshold",
+			config: `
+kubeConfigPath: "/path/to/kubeconfig"
+forceDeleteAfter: -1m
+`,
+			wantError: true,
+		},
+		{
+			name: "invalid configuration with negative burst",
+			config: `
+kubeConfigPath: "/path/to/kubeconfig"
+burst: -1
+`,
+			wantError: true,
+		},
+		{
+			name: "invalid configuration with negative pod ready timeout",
+			config: `
+kubeConfigPath: "/path/to/kubeconfig"
+podReadyTimeout: -2m
+`,
+			wantError: true,
+		},
+		{
+			name: "invalid configuration with negative operation timeout",
+			config: `
+kubeConfigPath: "/path/to/kubeconfig"
+operationTimeout: -1m
+`,
+			wantError: true,
+		},
+		{
+			name: "valid configuration with a flavor beyond resource requirements",
+			expected: config.ProviderConfig{
+				KubeConfigPath:      "/path/to/kubeconfig",
+				RunnerNamespace:     "runner",
+				RunnerInstallMode:   "image",
+				ToolsInstallerImage: "curlimages/curl:8.16.0",
+				UnknownFlavorPolicy: "best-effort",
+				PodTemplate: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{},
+					},
+				},
+				Flavors: map[string]config.Flavor{
+					"arm64-large": {
+						ResourceRequirements: corev1.ResourceRequirements{
+							Limits: corev1.ResourceList{
+								"nvidia.com/gpu": resource.MustParse("1"),
+							},
+							Requests: corev1.ResourceList{
+								corev1.ResourceCPU:              resource.MustParse("2"),
+								corev1.ResourceEphemeralStorage: resource.MustParse("10Gi"),
+							},
+						},
+						NodeSelector: map[string]string{
+							"kubernetes.io/arch": "arm64",
+						},
+						Tolerations: []corev1.Toleration{
+							{
+								Key:      "dedicated",
+								Operator: corev1.TolerationOpEqual,
+								Value:    "runner",
+								Effect:   corev1.TaintEffectNoSchedule,
+							},
+						},
+						PriorityClassName: "runner",
+						RuntimeClassName:  ptr.To("gvisor"),
+						PodTemplate: corev1.PodTemplateSpec{
+							Spec: corev1.PodSpec{
+								HostNetwork: true,
+							},
+						},
+					},
+				},
+			},
+			config: `
+kubeConfigPath: "/path/to/kubeconfig"
+flavors:
+  arm64-large:
+    requests:
+      cpu: 2
+      ephemeral-storage: 10Gi
+    limits:
+      nvidia.com/gpu: 1
+    nodeSelector:
+      kubernetes.io/arch: arm64
+    tolerations:
+    - key: dedicated
+      operator: Equal
+      value: runner
+      effect: NoSchedule
+    priorityClassName: runner
+    runtimeClassName: gvisor
+    podTemplate:
+      spec:
+        hostNetwork: true
+`,
+			wantError: false,
+		},
+		{
+			name: "valid configuration with default flavor policy",
+			expected: config.ProviderConfig{
+				KubeConfigPath:      "/path/to/kubeconfig",
+				RunnerNamespace:     "runner",
+				RunnerInstallMode:   "image",
+				ToolsInstallerImage: "curlimages/curl:8.16.0",
+				UnknownFlavorPolicy: "default-flavor",
+				DefaultFlavor:       "small",
+				PodTemplate: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{},
+					},
+				},
+				Flavors: map[string]config.Flavor{
+					"small": {ResourceRequirements: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{
+							corev1.ResourceCPU: resource.MustParse("500m"),
+						},
+					}},
+				},
+			},
+			config: `
+kubeConfigPath: "/path/to/kubeconfig"
+unknownFlavorPolicy: default-flavor
+defaultFlavor: small
+flavors:
+  small:
+    requests:
+      cpu: 500m
+`,
+			wantError: false,
+		},
+		{
+			name: "valid configuration with a default flavor of a named pod template",
+			expected: config.ProviderConfig{
+				KubeConfigPath:      "/path/to/kubeconfig",
+				RunnerNamespace:     "runner",
+				RunnerInstallMode:   "image",
+				ToolsInstallerImage: "curlimages/curl:8.16.0",
+				UnknownFlavorPolicy: "default-flavor",
+				DefaultFlavor:       "dind",
+				PodTemplate: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{},
+					},
+				},
+				PodTemplates: map[string]corev1.PodTemplateSpec{
+					"dind": {
+						Spec: corev1.PodSpec{
+							HostNetwork: true,
+						},
+					},
+				},
+			},
+			config: `
+kubeConfigPath: "/path/to/kubeconfig"
+unknownFlavorPolicy: default-flavor
+defaultFlavor: dind
+podTemplates:
+  dind:
+    spec:
+      hostNetwork: true
+`,
+			wantError: false,
+		},
+		{
+			name: "valid configuration with a default flavor routed to a cluster",
+			expected: config.ProviderConfig{
+				KubeConfigPath:      "/path/to/kubeconfig",
+				RunnerNamespace:     "runner",
+				RunnerInstallMode:   "image",
+				ToolsInstallerImage: "curlimages/curl:8.16.0",
+				UnknownFlavorPolicy: "reject",
+				DefaultFlavor:       "arm64-large",
+				PodTemplate: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{},
+					},
+				},
+				Clusters: map[string]config.ClusterConfig{
+					"arm": {
+						KubeConfigPath:  "/path/to/arm/kubeconfig",
+						RunnerNamespace: "runner",
+						Flavors:         []string{"arm64-large"},
+					},
+				},
+			},
+			config: `
+kubeConfigPath: "/path/to/kubeconfig"
+unknownFlavorPolicy: reject
+defaultFlavor: arm64-large
+clusters:
+  arm:
+    kubeConfigPath: "/path/to/arm/kubeconfig"
+    flavors: [arm64-large]
+`,
+			wantError: false,
+		},
+		{
+			name: "invalid configuration with unknown flavor policy",
+			config: `
+kubeConfigPath: "/path/to/kubeconfig"
+unknownFlavorPolicy: ignore
+`,
+			wantError: true,
+		},
+		{
+			name: "invalid configuration with default flavor policy without default flavor",
+			config: `
+kubeConfigPath: "/path/to/kubeconfig"
+unknownFlavorPolicy: default-flavor
+`,
+			wantError: true,
+		},
+		{
+			name: "invalid configuration with a default flavor which is not configured",
+			config: `
+kubeConfigPath: "/path/to/kubeconfig"
+unknownFlavorPolicy: default-flavor
+defaultFlavor: smal
+flavors:
+  small:
+    requests:
+      cpu: 500m
+`,
+			wantError: true,
+		},
+		{
+			name: "invalid configuration with an unknown field in the pod template of a flavor",
+			config: `
+kubeConfigPath: "/path/to/kubeconfig"
+flavors:
+  arm64-large:
+    podTemplate:
+      spec:
+        nodeSelectr:
+          kubernetes.io/arch: arm64
+`,
+			wantError: true,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -221,7 +883,7 @@ podTemplate:
 			require.NoError(t, err)
 
 			// Call NewConfig
-			err = config.NewConfig(tempConfigFile.Name())
+			cfg, err := config.NewConfig(tempConfigFile.Name())
 
 			// check if we expected an error
 			assert.Equal(t, tc.wantError, func() bool {
@@ -229,18 +891,328 @@ podTemplate:
 			}())
 
 			if tc.wantError == false && err == nil {
-				assert.Equal(t, tc.expected.KubeConfigPath, config.Config.KubeConfigPath)
-				assert.Equal(t, tc.expected.RunnerNamespace, config.Config.RunnerNamespace)
-				assert.Equal(t, tc.expected.PodTemplate, config.Config.PodTemplate)
-				assert.Equal(t, tc.expected.Flavors, config.Config.Flavors)
+				assert.Equal(t, tc.expected.KubeConfigPath, cfg.KubeConfigPath)
+				assert.Equal(t, tc.expected.DefaultCluster(), cfg.DefaultCluster())
+				assert.Equal(t, tc.expected.RunnerNamespace, cfg.RunnerNamespace)
+				assert.Equal(t, tc.expected.PodTemplate, cfg.PodTemplate)
+				assert.Equal(t, tc.expected.PodTemplates, cfg.PodTemplates)
+				assert.Equal(t, tc.expected.Flavors, cfg.Flavors)
+				assert.Equal(t, tc.expected.PodReadyTimeout, cfg.PodReadyTimeout)
+				assert.Equal(t, tc.expected.OperationTimeout, cfg.OperationTimeout)
+				assert.Equal(t, tc.expected.DeleteConcurrency, cfg.DeleteConcurrency)
+				assert.Equal(t, tc.expected.DeleteTimeout, cfg.DeleteTimeout)
+				assert.Equal(t, tc.expected.GracePeriodSeconds, cfg.GracePeriodSeconds)
+				assert.Equal(t, tc.expected.PropagationPolicy, cfg.PropagationPolicy)
+				assert.Equal(t, tc.expected.ForceDeleteAfter, cfg.ForceDeleteAfter)
+				assert.Equal(t, tc.expected.ForceDeleteOnNodeNotReady, cfg.ForceDeleteOnNodeNotReady)
+				assert.Equal(t, tc.expected.DeregistrationCommand, cfg.DeregistrationCommand)
+				assert.Equal(t, tc.expected.DeregistrationTimeout, cfg.DeregistrationTimeout)
+				assert.Equal(t, tc.expected.RunnerInstallMode, cfg.RunnerInstallMode)
+				assert.Equal(t, tc.expected.ToolsInstallerImage, cfg.ToolsInstallerImage)
+				assert.Equal(t, tc.expected.UnknownFlavorPolicy, cfg.UnknownFlavorPolicy)
+				assert.Equal(t, tc.expected.DefaultFlavor, cfg.DefaultFlavor)
+				assert.Equal(t, tc.expected.Clusters, cfg.Clusters)
+				assert.Equal(t, tc.expected.QPS, cfg.QPS)
+				assert.Equal(t, tc.expected.Burst, cfg.Burst)
 			}
+		})
+	}
+}
 
-			// empty the global config for the next run
-			config.Config = config.ProviderConfig{}
+func TestNewConfigStrictDecoding(t *testing.T) {
+	testCases := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{
+			name: "unknown top level key",
+			config: `
+kubeConfigPath: "/path/to/kubeconfig"
+runnerNamepsace: runner
+`,
+			wantErr: "runnerNamepsace",
+		},
+		{
+			name: "unknown key of a cluster",
+			config: `
+clusters:
+  arm:
+    kubeConfigPath: "/path/to/kubeconfig"
+    flavours: [small]
+`,
+			wantErr: "flavours",
+		},
+		{
+			name: "value of the wrong type",
+			config: `
+kubeConfigPath: "/path/to/kubeconfig"
+podReadyTimeout: soon
+`,
+			wantErr: "podReadyTimeout",
+		},
+		{
+			name: "invalid quantity of a flavor",
+			config: `
+kubeConfigPath: "/path/to/kubeconfig"
+flavors:
+  small:
+    requests:
+      cpu: 1.5cores
+`,
+			wantErr: "flavors.small: error unmarshaling JSON",
+		},
+		{
+			name: "unknown key of a flavor",
+			config: `
+kubeConfigPath: "/path/to/kubeconfig"
+flavors:
+  small:
+    request:
+      cpu: 500m
+`,
+			wantErr: `flavors.small: error unmarshaling JSON: while decoding JSON: json: unknown field "request"`,
+		},
+		{
+			name: "invalid container field of the pod template",
+			config: `
+kubeConfigPath: "/path/to/kubeconfig"
+podTemplate:
+  spec:
+    containers:
+    - name: runner
+      imagePullPolicy: Always
+      livenessProbe:
+        periodSeconds: often
+`,
+			wantErr: "podTemplate: error unmarshaling JSON",
+		},
+		{
+			name: "unknown container field of a named pod template",
+			config: `
+kubeConfigPath: "/path/to/kubeconfig"
+podTemplates:
+  dind:
+    spec:
+      containers:
+      - name: docker
+        imagee: docker:dind
+`,
+			wantErr: `podTemplates.dind: error unmarshaling JSON: while decoding JSON: json: unknown field "imagee"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tempConfigFile, err := setupTempFile(tc.config)
+			defer os.Remove(tempConfigFile.Name())
+			require.NoError(t, err)
+
+			_, err = config.NewConfig(tempConfigFile.Name())
+			assert.ErrorContains(t, err, tc.wantErr)
+		})
+	}
+}
+
+func TestSchemaMatchesConfig(t *testing.T) {
+	var schema struct {
+		Properties map[string]any `json:"properties"`
+		Defs       struct {
+			Cluster struct {
+				Properties map[string]any `json:"properties"`
+			} `json:"cluster"`
+		} `json:"$defs"`
+	}
+	err := json.Unmarshal(config.Schema, &schema)
+	require.NoError(t, err)
+
+	koanfKeys := func(v any) []string {
+		keys := []string{}
+		structType := reflect.TypeOf(v)
+		for i := 0; i < structType.NumField(); i++ {
+			keys = append(keys, structType.Field(i).Tag.Get("koanf"))
+		}
+		return keys
+	}
+	propertyNames := func(properties map[string]any) []string {
+		names := []string{}
+		for name := range properties {
+			names = append(names, name)
+		}
+		return names
+	}
+
+	assert.ElementsMatch(t, koanfKeys(config.ProviderConfig{}), propertyNames(schema.Properties))
+	assert.ElementsMatch(t, koanfKeys(config.ClusterConfig{}), propertyNames(schema.Defs.Cluster.Properties))
+}
+
+func TestNewConfigLayering(t *testing.T) {
+	testCases := []struct {
+		name      string
+		overlays  map[string]string
+		env       map[string]string
+		expected  *config.ProviderConfig
+		wantError string
+	}{
+		{
+			name: "base file only",
+			expected: &config.ProviderConfig{
+				KubeConfigPath:  "/path/to/kubeconfig",
+				RunnerNamespace: "runner",
+				Flavors: map[string]config.Flavor{
+					"small": {ResourceRequirements: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")}}},
+				},
+			},
+		},
+		{
+			name: "overlays are merged in order",
+			overlays: map[string]string{
+				"20-namespace.yaml": "runnerNamespace: overlay-20\n",
+				"10-namespace.yaml": "runnerNamespace: overlay-10\ndeleteTimeout: 1m\n",
+				"30-flavors.yml": `
+flavors:
+  large:
+    requests:
+      cpu: 1
+`,
+				"README.md": "not: [a, config",
+			},
+			expected: &config.ProviderConfig{
+				KubeConfigPath:  "/path/to/kubeconfig",
+				RunnerNamespace: "overlay-20",
+				DeleteTimeout:   time.Minute,
+				Flavors: map[string]config.Flavor{
+					"small": {ResourceRequirements: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")}}},
+					"large": {ResourceRequirements: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")}}},
+				},
+			},
+		},
+		{
+			name: "environment overrides files",
+			overlays: map[string]string{
+				"10-namespace.yaml": "runnerNamespace: overlay-10\n",
+			},
+			env: map[string]string{
+				"GARM_K8S_RUNNER_NAMESPACE":               "env",
+				"GARM_K8S_KUBE_CONFIG_PATH":               "/path/to/env/kubeconfig",
+				"GARM_K8S_QPS":                            "7.5",
+				"GARM_K8S_GRACE_PERIOD_SECONDS":           "30",
+				"GARM_K8S_FORCE_DELETE_ON_NODE_NOT_READY": "true",
+				"GARM_K8S_POD_READY_TIMEOUT":              "90s",
+			},
+			expected: &config.ProviderConfig{
+				KubeConfigPath:            "/path/to/env/kubeconfig",
+				RunnerNamespace:           "env",
+				QPS:                       7.5,
+				GracePeriodSeconds:        ptr.To[int64](30),
+				ForceDeleteOnNodeNotReady: true,
+				PodReadyTimeout:           90 * time.Second,
+				Flavors: map[string]config.Flavor{
+					"small": {ResourceRequirements: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")}}},
+				},
+			},
+		},
+		{
+			name: "unknown environment variables are ignored",
+			env: map[string]string{
+				"GARM_K8S_FOO_SERVICE_HOST": "10.96.0.10",
+				"GARM_K8S_FOO_SERVICE_PORT": "443",
+			},
+			expected: &config.ProviderConfig{
+				KubeConfigPath:  "/path/to/kubeconfig",
+				RunnerNamespace: "runner",
+				Flavors: map[string]config.Flavor{
+					"small": {ResourceRequirements: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")}}},
+				},
+			},
+		},
+		{
+			name: "invalid environment value",
+			env: map[string]string{
+				"GARM_K8S_BURST": "many",
+			},
+			wantError: "burst",
+		},
+		{
+			name: "invalid overlay",
+			overlays: map[string]string{
+				"10-namespace.yaml": "runnerNamepsace: overlay-10\n",
+			},
+			wantError: "runnerNamepsace",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			err := os.WriteFile(configPath, []byte(`
+kubeConfigPath: "/path/to/kubeconfig"
+runnerNamespace: "runner"
+flavors:
+  small:
+    requests:
+      cpu: 100m
+`), 0o600)
+			require.NoError(t, err)
+
+			if len(tc.overlays) > 0 {
+				require.NoError(t, os.Mkdir(config.OverlayDir(configPath), 0o700))
+			}
+			for name, content := range tc.overlays {
+				err := os.WriteFile(filepath.Join(config.OverlayDir(configPath), name), []byte(content), 0o600)
+				require.NoError(t, err)
+			}
+			for name, value := range tc.env {
+				t.Setenv(name, value)
+			}
+
+			cfg, err := config.NewConfig(configPath)
+			if tc.wantError != "" {
+				assert.ErrorContains(t, err, tc.wantError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected.KubeConfigPath, cfg.KubeConfigPath)
+			assert.Equal(t, tc.expected.RunnerNamespace, cfg.RunnerNamespace)
+			assert.Equal(t, tc.expected.Flavors, cfg.Flavors)
+			assert.Equal(t, tc.expected.DeleteTimeout, cfg.DeleteTimeout)
+			assert.Equal(t, tc.expected.QPS, cfg.QPS)
+			assert.Equal(t, tc.expected.GracePeriodSeconds, cfg.GracePeriodSeconds)
+			assert.Equal(t, tc.expected.ForceDeleteOnNodeNotReady, cfg.ForceDeleteOnNodeNotReady)
+			assert.Equal(t, tc.expected.PodReadyTimeout, cfg.PodReadyTimeout)
 		})
 	}
 }
 
+func TestEffectiveConfig(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(configPath, []byte(`
+kubeConfig: "apiVersion: v1"
+runnerNamespace: "runner"
+clusters:
+  arm:
+    kubeConfig: "apiVersion: v1"
+    flavors: [arm64]
+`), 0o600)
+	require.NoError(t, err)
+	require.NoError(t, os.Mkdir(config.OverlayDir(configPath), 0o700))
+	err = os.WriteFile(filepath.Join(config.OverlayDir(configPath), "10-timeout.yaml"), []byte("deleteTimeout: 1m\n"), 0o600)
+	require.NoError(t, err)
+	t.Setenv("GARM_K8S_RUNNER_NAMESPACE", "env")
+
+	effectiveConfig, err := config.EffectiveConfig(configPath)
+	require.NoError(t, err)
+	assert.YAMLEq(t, `
+kubeConfig: REDACTED
+runnerNamespace: env
+deleteTimeout: 1m
+clusters:
+  arm:
+    kubeConfig: REDACTED
+    flavors: [arm64]
+`, string(effectiveConfig))
+}
+
 func setupTempFile(content string) (*os.File, error) {
 	tmpfile, err := os.CreateTemp("", "testconfig.*.yaml")
 	if err != nil {
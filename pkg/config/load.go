@@ -0,0 +1,178 @@
+// SPDX-License-Identifier: MIT
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+
+	koanfYaml "github.com/knadh/koanf/parsers/yaml"
+	"github.com/knadh/koanf/providers/file"
+	"github.com/knadh/koanf/v2"
+)
+
+// EnvPrefix is the prefix of the environment variables overriding scalar fields of the config,
+// e.g. GARM_K8S_RUNNER_NAMESPACE overrides runnerNamespace
+const EnvPrefix = "GARM_K8S_"
+
+// redacted replaces secrets in the printed config
+const redacted = "REDACTED"
+
+// OverlayDir returns the directory of the overlay files of a config file,
+// e.g. /etc/garm/provider-config.d for /etc/garm/provider-config.yaml
+func OverlayDir(configPath string) string {
+	return strings.TrimSuffix(configPath, filepath.Ext(configPath)) + ".d"
+}
+
+// load merges the config file, the yaml files of its overlay directory in lexical order
+// and the environment overrides. Maps are merged, all other values are replaced.
+func load(configPath string) (*koanf.Koanf, error) {
+	k := koanf.New(".")
+
+	if configPath == "" {
+		return nil, errors.New("no config file path provided")
+	}
+
+	// load the config file
+	if err := k.Load(file.Provider(configPath), koanfYaml.Parser()); err != nil {
+		return nil, err
+	}
+
+	overlays, err := overlayFiles(OverlayDir(configPath))
+	if err != nil {
+		return nil, err
+	}
+	for _, overlay := range overlays {
+		if err := k.Load(file.Provider(overlay), koanfYaml.Parser()); err != nil {
+			return nil, fmt.Errorf("failed to load overlay %s: %w", overlay, err)
+		}
+	}
+
+	if err := loadEnv(k); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// overlayFiles returns the yaml files of the overlay directory sorted by name.
+// The overlay directory is optional.
+func overlayFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read overlay directory %s: %w", dir, err)
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		switch filepath.Ext(entry.Name()) {
+		case ".yaml", ".yml":
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// loadEnv overrides the scalar fields of the config with the environment variables
+// prefixed with EnvPrefix. Unknown variables with the prefix are ignored, as e.g. kubernetes
+// injects <SERVICE>_SERVICE_HOST variables for services named like garm-k8s-*.
+func loadEnv(k *koanf.Koanf) error {
+	keys := envKeys()
+	for _, env := range os.Environ() {
+		name, value, _ := strings.Cut(env, "=")
+		if !strings.HasPrefix(name, EnvPrefix) {
+			continue
+		}
+
+		key, ok := keys[name]
+		if !ok {
+			slog.Info(fmt.Sprintf("Ignoring unknown environment variable %s", name))
+			continue
+		}
+		if err := k.Set(key, value); err != nil {
+			return fmt.Errorf("failed to set %s from %s: %w", key, name, err)
+		}
+	}
+	return nil
+}
+
+// envKeys maps the environment variables to the keys of all scalar fields of ProviderConfig
+func envKeys() map[string]string {
+	keys := map[string]string{}
+	configType := reflect.TypeOf(ProviderConfig{})
+	for i := 0; i < configType.NumField(); i++ {
+		field := configType.Field(i)
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+
+		switch fieldType.Kind() {
+		case reflect.Struct, reflect.Map, reflect.Slice:
+			continue
+		}
+
+		key := field.Tag.Get("koanf")
+		keys[envName(key)] = key
+	}
+	return keys
+}
+
+// envName converts a config key to its environment variable, e.g. apiServerURL to GARM_K8S_API_SERVER_URL
+func envName(key string) string {
+	var name strings.Builder
+	name.WriteString(EnvPrefix)
+
+	runes := []rune(key)
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) && (unicode.IsLower(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+			name.WriteRune('_')
+		}
+		name.WriteRune(unicode.ToUpper(r))
+	}
+	return name.String()
+}
+
+// EffectiveConfig returns the merged config of the config file, its overlays and the
+// environment overrides as yaml, after validating it. Inline kubeconfigs are redacted.
+func EffectiveConfig(configPath string) ([]byte, error) {
+	k, err := load(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// decoding removes keys, so validate a copy
+	if _, err := decode(k.Copy()); err != nil {
+		return nil, err
+	}
+
+	if k.String("kubeConfig") != "" {
+		if err := k.Set("kubeConfig", redacted); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range k.MapKeys("clusters") {
+		key := "clusters." + name + ".kubeConfig"
+		if k.String(key) == "" {
+			continue
+		}
+		if err := k.Set(key, redacted); err != nil {
+			return nil, err
+		}
+	}
+
+	return k.Marshal(koanfYaml.Parser())
+}
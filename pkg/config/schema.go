@@ -0,0 +1,13 @@
+// SPDX-License-Identifier: MIT
+
+package config
+
+import (
+	_ "embed"
+)
+
+// Schema is the JSON schema of the provider config,
+// e.g. to validate config files in editors or CI pipelines
+//
+//go:embed schema.json
+var Schema []byte
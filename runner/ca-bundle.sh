@@ -0,0 +1,24 @@
+#!/bin/bash
+# SPDX-License-Identifier: MIT
+
+# Sourced by the entrypoints of the runner images. If garm passed a CA bundle (GARM_CA_BUNDLE_FILE),
+# it is combined with the CAs of the system and SSL_CERT_FILE and CURL_CA_BUNDLE are exported,
+# so the runner trusts both. CURL_CA_ARGS passes the combined bundle to curl.
+
+CURL_CA_ARGS=()
+if [ -n "$GARM_CA_BUNDLE_FILE" ] && [ -f "$GARM_CA_BUNDLE_FILE" ]; then
+    # trust the system CAs as well as the CA bundle passed by garm
+    CA_BUNDLE="${RUNNER_HOME}/.garm-ca-bundle.crt"
+    : > "$CA_BUNDLE"
+    for SYSTEM_CA_BUNDLE in /etc/ssl/certs/ca-certificates.crt /etc/pki/tls/certs/ca-bundle.crt; do
+        if [ -f "$SYSTEM_CA_BUNDLE" ]; then
+            cat "$SYSTEM_CA_BUNDLE" >> "$CA_BUNDLE"
+            break
+        fi
+    done
+    cat "$GARM_CA_BUNDLE_FILE" >> "$CA_BUNDLE"
+
+    export SSL_CERT_FILE="$CA_BUNDLE"
+    export CURL_CA_BUNDLE="$CA_BUNDLE"
+    CURL_CA_ARGS=(--cacert "$CA_BUNDLE")
+fi
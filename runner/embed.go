@@ -0,0 +1,17 @@
+// SPDX-License-Identifier: MIT
+
+package runner
+
+import _ "embed"
+
+// UpstreamEntrypoint is the entrypoint of the upstream runner image.
+// It is mounted into stock base images if the runner is installed from the garm tools.
+//
+//go:embed upstream/entrypoint.sh
+var UpstreamEntrypoint string
+
+// CABundleScript is sourced by the entrypoints to combine the CA bundle passed by garm with the system CAs.
+// It is mounted next to the UpstreamEntrypoint.
+//
+//go:embed ca-bundle.sh
+var CABundleScript string
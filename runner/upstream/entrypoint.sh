@@ -22,11 +22,25 @@ if [ -z "$CALLBACK_URL" ]; then
     exit 1
 fi
 
+if [ "${RUNNER_INSTALL_DEPENDENCIES:-}" == "true" ]; then
+    # stock base images neither ship curl nor the dependencies of the runner
+    if ! command -v curl >/dev/null && command -v apt-get >/dev/null; then
+        apt-get update
+        DEBIAN_FRONTEND=noninteractive apt-get install -y --no-install-recommends curl ca-certificates
+    fi
+    if [ -x "$RUNNER_ASSETS_DIR/bin/installdependencies.sh" ]; then
+        "$RUNNER_ASSETS_DIR/bin/installdependencies.sh"
+    fi
+fi
+
+# combines the CA bundle passed by garm with the system CAs and sets CURL_CA_ARGS
+source "$(dirname "${BASH_SOURCE[0]}")/ca-bundle.sh"
+
 function call() {
     PAYLOAD="$1"
     local cb_url=$CALLBACK_URL
     [[ $cb_url =~ ^(.*)/status(/)?$ ]] || cb_url="${cb_url}/status"
-    curl --retry 5 --retry-delay 5 --retry-connrefused --fail -s -X POST -d "${PAYLOAD}" -H 'Accept: application/json' -H "Authorization: Bearer ${BEARER_TOKEN}" "${cb_url}" || echo "failed to call home: exit code ($?)"
+    curl "${CURL_CA_ARGS[@]}" --retry 5 --retry-delay 5 --retry-connrefused --fail -s -X POST -d "${PAYLOAD}" -H 'Accept: application/json' -H "Authorization: Bearer ${BEARER_TOKEN}" "${cb_url}" || echo "failed to call home: exit code ($?)"
 }
 
 function systemInfo() {
@@ -41,7 +55,7 @@ function systemInfo() {
     [[ $cb_url =~ ^(.*)/status(/)?$ ]] && cb_url="${BASH_REMATCH[1]}" || true
     SYSINFO_URL="${cb_url}/system-info/"
     PAYLOAD="{\"os_name\": \"$OS_NAME\", \"os_version\": \"$OS_VERSION\", \"agent_id\": $AGENT_ID}"
-    curl --retry 5 --retry-delay 5 --retry-connrefused --fail -s -X POST -d "${PAYLOAD}" -H 'Accept: application/json' -H "Authorization: Bearer ${BEARER_TOKEN}" "${SYSINFO_URL}" || true
+    curl "${CURL_CA_ARGS[@]}" --retry 5 --retry-delay 5 --retry-connrefused --fail -s -X POST -d "${PAYLOAD}" -H 'Accept: application/json' -H "Authorization: Bearer ${BEARER_TOKEN}" "${SYSINFO_URL}" || true
 }
 
 function sendStatus() {
@@ -66,7 +80,7 @@ function success() {
 }
 
 function getRunnerFile() {
-    curl --retry 5 --retry-delay 5 \
+    curl "${CURL_CA_ARGS[@]}" --retry 5 --retry-delay 5 \
         --retry-connrefused --fail -s \
         -X GET -H 'Accept: application/json' \
         -H "Authorization: Bearer ${BEARER_TOKEN}" \
@@ -106,9 +120,12 @@ function check_runner {
     set -e
 }
 
-shopt -s dotglob
-cp -r "$RUNNER_ASSETS_DIR"/* "$RUNNER_HOME"/
-shopt -u dotglob
+# the runner is already in place if it got installed from the garm tools
+if [ "$(realpath "$RUNNER_ASSETS_DIR")" != "$(realpath "$RUNNER_HOME")" ]; then
+    shopt -s dotglob
+    cp -r "$RUNNER_ASSETS_DIR"/* "$RUNNER_HOME"/
+    shopt -u dotglob
+fi
 
 pushd "$RUNNER_HOME"
 
@@ -148,7 +165,7 @@ else
         config_args+=(--runnergroup "$RUNNER_GROUP")
     fi
 
-    GITHUB_TOKEN=$(curl --retry 5 --retry-delay 5 --retry-connrefused --fail -s -X GET -H 'Accept: application/json' -H "Authorization: Bearer ${BEARER_TOKEN}" "${METADATA_URL}/runner-registration-token/")
+    GITHUB_TOKEN=$(curl "${CURL_CA_ARGS[@]}" --retry 5 --retry-delay 5 --retry-connrefused --fail -s -X GET -H 'Accept: application/json' -H "Authorization: Bearer ${BEARER_TOKEN}" "${METADATA_URL}/runner-registration-token/")
     set +e
     attempt=1
     while true; do